@@ -0,0 +1,422 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/NoteToScreen/maily-go/maily"
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/mail"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
+	"github.com/whiskeybrav/studentclubportal-server/util"
+)
+
+const (
+	TransferPending   = "pending"
+	TransferAccepted  = "accepted"
+	TransferCancelled = "cancelled"
+	TransferExpired   = "expired"
+)
+
+type AdviserTransfer struct {
+	ID        int    `json:"id"`
+	From      User   `json:"from"`
+	To        User   `json:"to"`
+	Status    string `json:"status"`
+	ByAdmin   bool   `json:"by_admin"`
+	Created   string `json:"created"`
+	Expiry    string `json:"expiry"`
+	Accepted  string `json:"accepted"`
+	Cancelled string `json:"cancelled"`
+}
+
+type AdviserTransfersResponse struct {
+	Status    string            `json:"status"`
+	Transfers []AdviserTransfer `json:"transfers"`
+}
+
+type acceptAdviserRequest struct {
+	Key string `json:"key" form:"key" validate:"required"`
+}
+
+type setAdviserRequest struct {
+	SchoolID int `json:"schoolId" form:"schoolId" validate:"required"`
+	UserID   int `json:"userId" form:"userId" validate:"required"`
+}
+
+// adviserTransfersRequest is only read for admins, who can look at any school.
+type adviserTransfersRequest struct {
+	SchoolID int `json:"schoolId" form:"schoolId"`
+}
+
+// changeAdviser hands the school over from one adviser to another. It returns false if fromUserId isn't the school's
+// adviser anymore, in which case nothing is changed.
+func changeAdviser(q execer, schoolId int, fromUserId int, toUserId int) (bool, error) {
+	result, err := q.Exec("UPDATE schools SET facultyadviserId = ? WHERE id = ? AND facultyadviserId = ?", toUserId, schoolId, fromUserId)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return changed == 1, nil
+}
+
+// announceAdviserChange lets both advisers know that the school was handed over.
+func announceAdviserChange(schoolId int, fromUserId int, toUserId int) {
+	var schoolName, displayName string
+	err := db.QueryRow("SELECT name, displayname FROM schools WHERE id = ?", schoolId).Scan(&schoolName, &displayName)
+	if err != nil {
+		logging.Log.Error("getting school for adviser notification", err)
+		return
+	}
+
+	notifyUsers([]int{toUserId}, notifications.Notification{
+		Type:  notifications.TypeAdviserChanged,
+		Title: "You're now the faculty adviser",
+		Body:  "You are now the faculty adviser of " + schoolName + ".",
+		Link:  "/" + displayName,
+	})
+
+	if fromUserId != -1 {
+		notifyUsers([]int{fromUserId}, notifications.Notification{
+			Type:  notifications.TypeAdviserChanged,
+			Title: "You're no longer the faculty adviser",
+			Body:  "The faculty adviser role of " + schoolName + " has been handed over.",
+			Link:  "/" + displayName,
+		})
+	}
+}
+
+func ConfigureAdviser(e *router) {
+	e.POST("/schools/nominateAdviser", func(c echo.Context) error {
+		request := idRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		nomineeId := request.ID
+		session := authentication.GetSession(c)
+
+		var schoolId int
+		var schoolName string
+
+		err = db.QueryRow("SELECT id, name from schools WHERE facultyadviserId = ?", session.UserID).Scan(&schoolId, &schoolName)
+		if err == sql.ErrNoRows || session.UserID == -1 {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		if nomineeId == session.UserID {
+			return apierr.BadRequest("invalid_params")
+		}
+
+		ok, err := checkMember(nomineeId, schoolId, UserTypeTeacher)
+		if err != nil {
+			return apierr.Internal("checking adviser nominee", err)
+		}
+		if !ok {
+			return apierr.BadRequest("invalid_nominee")
+		}
+
+		key, err := util.GenerateRandomString(26)
+		if err != nil {
+			return apierr.Internal("generating adviser transfer key", err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return apierr.Internal("starting adviser transfer", err)
+		}
+
+		defer tx.Rollback()
+
+		// only the latest nomination can be accepted
+		_, err = tx.Exec("UPDATE adviserTransfers SET cancelled = NOW() WHERE schoolId = ? AND accepted IS NULL AND cancelled IS NULL", schoolId)
+		if err != nil {
+			return apierr.Internal("cancelling old adviser transfers", err)
+		}
+
+		_, err = tx.Exec("INSERT INTO adviserTransfers (schoolId, fromUserId, toUserId, `key`, created, expiry) VALUES (?, ?, ?, ?, NOW(), ADDDATE(NOW(), INTERVAL 7 DAY))", schoolId, session.UserID, nomineeId, key)
+		if err != nil {
+			return apierr.Internal("adding adviser transfer", err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return apierr.Internal("committing adviser transfer", err)
+		}
+
+		var fname, lname, email, adviserFName, adviserLName string
+
+		err = db.QueryRow("SELECT fname, lname, email FROM users WHERE id = ?", nomineeId).Scan(&fname, &lname, &email)
+		if err != nil {
+			return apierr.Internal("getting adviser nominee", err)
+		}
+
+		err = db.QueryRow("SELECT fname, lname FROM users WHERE id = ?", session.UserID).Scan(&adviserFName, &adviserLName)
+		if err != nil {
+			return apierr.Internal("getting adviser name", err)
+		}
+
+		err = mail.Send(fname+" "+lname, email, "adviserTransfer", maily.TemplateData{
+			"fname":       fname,
+			"adviserName": adviserFName + " " + adviserLName,
+			"schoolName":  schoolName,
+			"key":         key,
+		})
+		if err != nil {
+			// the nomination is saved, so the adviser can nominate again to resend the email
+			logging.FromContext(c).Error("sending adviser transfer mail", err)
+		}
+
+		return statusOk(c)
+	})
+
+	e.POST("/schools/cancelAdviserTransfer", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		var schoolId int
+
+		err := db.QueryRow("SELECT id from schools WHERE facultyadviserId = ?", session.UserID).Scan(&schoolId)
+		if err == sql.ErrNoRows || session.UserID == -1 {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		_, err = db.Exec("UPDATE adviserTransfers SET cancelled = NOW() WHERE schoolId = ? AND accepted IS NULL AND cancelled IS NULL", schoolId)
+		if err != nil {
+			return apierr.Internal("cancelling adviser transfer", err)
+		}
+
+		return statusOk(c)
+	})
+
+	e.POST("/schools/acceptAdviser", func(c echo.Context) error {
+		request := acceptAdviserRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		session := authentication.GetSession(c)
+		if session.UserID == -1 {
+			return apierr.Unauthorized("logged_out")
+		}
+
+		var transferId, schoolId, fromUserId, toUserId int
+
+		err = db.QueryRow("SELECT id, schoolId, fromUserId, toUserId FROM adviserTransfers WHERE `key` = ? AND expiry > NOW() AND accepted IS NULL AND cancelled IS NULL", request.Key).Scan(&transferId, &schoolId, &fromUserId, &toUserId)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("no_transfer_available")
+		}
+		if err != nil {
+			return apierr.Internal("getting adviser transfer", err)
+		}
+
+		if toUserId != session.UserID {
+			return forbidden(c)
+		}
+
+		ok, err := checkMember(toUserId, schoolId, UserTypeTeacher)
+		if err != nil {
+			return apierr.Internal("checking adviser nominee", err)
+		}
+		if !ok {
+			return apierr.BadRequest("invalid_nominee")
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return apierr.Internal("starting adviser transfer", err)
+		}
+
+		defer tx.Rollback()
+
+		result, err := tx.Exec("UPDATE adviserTransfers SET accepted = NOW() WHERE id = ? AND accepted IS NULL AND cancelled IS NULL", transferId)
+		if err != nil {
+			return apierr.Internal("accepting adviser transfer", err)
+		}
+
+		accepted, err := result.RowsAffected()
+		if err != nil {
+			return apierr.Internal("accepting adviser transfer", err)
+		}
+		if accepted != 1 {
+			// it was cancelled or accepted since we looked it up
+			return apierr.NotFound("no_transfer_available")
+		}
+
+		changed, err := changeAdviser(tx, schoolId, fromUserId, toUserId)
+		if err != nil {
+			return apierr.Internal("changing adviser", err)
+		}
+		if !changed {
+			// the school changed hands some other way since the nomination
+			return apierr.NotFound("no_transfer_available")
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return apierr.Internal("committing adviser transfer", err)
+		}
+
+		announceAdviserChange(schoolId, fromUserId, toUserId)
+
+		return statusOk(c)
+	})
+
+	e.POST("/admin/setAdviser", func(c echo.Context) error {
+		request := setAdviserRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		schoolId, userId := request.SchoolID, request.UserID
+		session := authentication.GetSession(c)
+
+		if !isAdmin(session.UserID) {
+			return forbidden(c)
+		}
+
+		var currentAdviserId int
+		err = db.QueryRow("SELECT facultyadviserId FROM schools WHERE id = ?", schoolId).Scan(&currentAdviserId)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("invalid_school")
+		}
+		if err != nil {
+			return apierr.Internal("getting school", err)
+		}
+
+		ok, err := checkMember(userId, schoolId, UserTypeTeacher)
+		if err != nil {
+			return apierr.Internal("checking adviser nominee", err)
+		}
+		if !ok {
+			return apierr.BadRequest("invalid_nominee")
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return apierr.Internal("starting adviser override", err)
+		}
+
+		defer tx.Rollback()
+
+		_, err = tx.Exec("UPDATE adviserTransfers SET cancelled = NOW() WHERE schoolId = ? AND accepted IS NULL AND cancelled IS NULL", schoolId)
+		if err != nil {
+			return apierr.Internal("cancelling old adviser transfers", err)
+		}
+
+		_, err = tx.Exec("INSERT INTO adviserTransfers (schoolId, fromUserId, toUserId, created, accepted, byAdmin) VALUES (?, ?, ?, NOW(), NOW(), ?)", schoolId, currentAdviserId, userId, session.UserID)
+		if err != nil {
+			return apierr.Internal("recording adviser override", err)
+		}
+
+		changed, err := changeAdviser(tx, schoolId, currentAdviserId, userId)
+		if err != nil {
+			return apierr.Internal("changing adviser", err)
+		}
+		if !changed {
+			return apierr.Conflict("adviser_changed")
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return apierr.Internal("committing adviser override", err)
+		}
+
+		announceAdviserChange(schoolId, currentAdviserId, userId)
+
+		return statusOk(c)
+	})
+
+	e.GET("/schools/getAdviserTransfers", func(c echo.Context) error {
+		request := adviserTransfersRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		session := authentication.GetSession(c)
+
+		// admins can look at any school, even if they're an adviser themselves
+		admin := isAdmin(session.UserID)
+		schoolId := request.SchoolID
+
+		if !admin || schoolId == 0 {
+			err = db.QueryRow("SELECT id from schools WHERE facultyadviserId = ?", session.UserID).Scan(&schoolId)
+			if err == sql.ErrNoRows || session.UserID == -1 {
+				if admin {
+					return apierr.Invalid(apierr.Field("schoolId", "required"))
+				}
+				return forbidden(c)
+			}
+			if err != nil {
+				return apierr.Internal("checking permissions", err)
+			}
+		}
+
+		rows, err := db.Query("SELECT t.id, t.created, t.expiry, t.accepted, t.cancelled, t.byAdmin, t.expiry < NOW(), f.id, f.fname, f.lname, n.id, n.fname, n.lname FROM adviserTransfers t LEFT OUTER JOIN users f ON t.fromUserId = f.id INNER JOIN users n ON t.toUserId = n.id WHERE t.schoolId = ? ORDER BY t.created DESC", schoolId)
+		if err != nil {
+			return apierr.Internal("getting adviser transfers", err)
+		}
+
+		defer rows.Close()
+
+		transfers := []AdviserTransfer{}
+
+		for rows.Next() {
+			transfer := AdviserTransfer{From: User{GradeLevel: -1}, To: User{GradeLevel: -1}}
+			var expiry, accepted, cancelled sql.NullString
+			var byAdmin, fromId sql.NullInt64
+			var expired sql.NullBool
+			var fromFName, fromLName sql.NullString
+			var toFName, toLName string
+
+			err := rows.Scan(&transfer.ID, &transfer.Created, &expiry, &accepted, &cancelled, &byAdmin, &expired, &fromId, &fromFName, &fromLName, &transfer.To.Id, &toFName, &toLName)
+			if err != nil {
+				return apierr.Internal("scanning adviser transfer", err)
+			}
+
+			transfer.From.Id = int(fromId.Int64)
+			if fromId.Valid {
+				transfer.From.Name = fromFName.String + " " + fromLName.String
+			} else {
+				transfer.From.Id = -1
+			}
+			transfer.To.Name = toFName + " " + toLName
+			transfer.Expiry = expiry.String
+			transfer.Accepted = accepted.String
+			transfer.Cancelled = cancelled.String
+			transfer.ByAdmin = byAdmin.Valid
+
+			switch {
+			case accepted.Valid:
+				transfer.Status = TransferAccepted
+			case cancelled.Valid:
+				transfer.Status = TransferCancelled
+			case expired.Bool:
+				transfer.Status = TransferExpired
+			default:
+				transfer.Status = TransferPending
+			}
+
+			transfers = append(transfers, transfer)
+		}
+
+		return c.JSON(http.StatusOK, AdviserTransfersResponse{"ok", transfers})
+	})
+}
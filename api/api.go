@@ -3,7 +3,9 @@ package api
 import (
 	"database/sql"
 	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
 	"github.com/whiskeybrav/studentclubportal-server/configuration"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
 	"github.com/whiskeybrav/studentclubportal-server/version"
 	"net/http"
 	"time"
@@ -14,11 +16,6 @@ type VersionResponse struct {
 	Version string `json:"version"`
 }
 
-type ErrorResponse struct {
-	Status string `json:"status"`
-	Error  string `json:"error"`
-}
-
 type StatusResponse struct {
 	Status string `json:"status"`
 }
@@ -30,32 +27,49 @@ func statusOk(c echo.Context) error {
 	return c.JSON(http.StatusOK, StatusResponse{"ok"})
 }
 
-func checkErr(err error, msg string) ErrorResponse {
-	if err != nil {
-		return ErrorResponse{
-			Status: "error",
-			Error:  msg,
-		}
-	} else {
-		return ErrorResponse{}
+func Configure(e *echo.Echo, configuration *configuration.Config, database *sql.DB) {
+	config = configuration
+	db = database
+
+	r := newRouter(e)
+	addRoutes(r)
+
+	openAPI = buildOpenAPIDocument()
+	for _, problem := range r.check(openAPI) {
+		logging.Log.Warn("route doesn't match its documentation", logging.Fields{"problem": problem})
 	}
 }
 
-func Configure(e *echo.Echo, configuration *configuration.Config, database *sql.DB) {
-	e.GET("/", func(c echo.Context) error {
+// addRoutes adds every handler to the router.
+func addRoutes(r *router) {
+	r.GET("/", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, VersionResponse{"ok", version.Version})
 	})
 
-	config = configuration
-	db = database
+	ConfigureHealth(r)
+	ConfigureAuth(r)
+	ConfigureSchools(r)
+	ConfigurePosts(r)
+	ConfigureEvents(r)
+	ConfigureAttachments(r)
+	ConfigureNotifications(r)
+	ConfigureStream(r)
+	ConfigureMembers(r)
+	ConfigureInvites(r)
+	ConfigureImport(r)
+	ConfigureExports(r)
+	ConfigureRoles(r)
+	ConfigureAdviser(r)
+	ConfigureSchoolProfile(r)
+	ConfigureDonations(r)
+	ConfigureCampaigns(r)
 
-	ConfigureAuth(e)
-	ConfigureSchools(e)
-	ConfigurePosts(e)
-	ConfigureEvents(e)
+	r.GET("/teapot", func(c echo.Context) error {
+		return apierr.New(http.StatusTeapot, "requested_body_is_short_and_stout")
+	})
 
-	e.GET("/teapot", func(c echo.Context) error {
-		return c.JSON(http.StatusTeapot, ErrorResponse{"error", "requested_body_is_short_and_stout"})
+	r.GET("/v1/openapi.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, openAPI)
 	})
 }
 
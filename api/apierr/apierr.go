@@ -0,0 +1,176 @@
+// Package apierr is how handlers report errors. A handler returns an *Error, like apierr.NotFound("invalid_school"),
+// and Handler turns it into the response, so every error looks the same to clients.
+package apierr
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+)
+
+// FieldError says what's wrong with one field of a request.
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// Field says that a field has the problem given by code, which is one of FieldCodes.
+func Field(field, code string) FieldError {
+	return FieldError{field, code}
+}
+
+// ValidationErrors lists what's wrong with each field of a request.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, fieldError := range e {
+		parts[i] = fieldError.Field + ": " + fieldError.Error
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Error is an error response.
+type Error struct {
+	Status int
+	Code   string
+	Fields []FieldError
+
+	// message and err explain internal errors in the log. They're never sent to the client.
+	message string
+	err     error
+}
+
+// Response is the body of every error response.
+type Response struct {
+	Status    string       `json:"status"`
+	Error     string       `json:"error"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.err != nil {
+		return e.Code + ": " + e.message + ": " + e.err.Error()
+	}
+	return e.Code
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// WithFields adds details about which fields were wrong.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	e.Fields = append(e.Fields, fields...)
+	return e
+}
+
+func New(status int, code string) *Error {
+	return &Error{Status: status, Code: code}
+}
+
+func BadRequest(code string) *Error {
+	return New(http.StatusBadRequest, code)
+}
+
+func Unauthorized(code string) *Error {
+	return New(http.StatusUnauthorized, code)
+}
+
+func Forbidden(code string) *Error {
+	return New(http.StatusForbidden, code)
+}
+
+func NotFound(code string) *Error {
+	return New(http.StatusNotFound, code)
+}
+
+func Conflict(code string) *Error {
+	return New(http.StatusConflict, code)
+}
+
+// Internal is for anything that isn't the client's fault. The message and error are logged, and the client only gets
+// internal_server_error.
+func Internal(message string, err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: "internal_server_error", message: message, err: err}
+}
+
+// specificFieldErrors are field errors that the frontend already handles on their own, so they are also used as the
+// top level error. Anything else is reported as invalid_params.
+var specificFieldErrors = map[string]bool{
+	"invalid_email":     true,
+	"insecure_password": true,
+}
+
+// Invalid is for requests with fields that are missing or wrong.
+func Invalid(fields ...FieldError) *Error {
+	code := "invalid_params"
+	if len(fields) > 0 && specificFieldErrors[fields[0].Error] {
+		code = fields[0].Error
+	}
+	return BadRequest(code).WithFields(fields...)
+}
+
+// From turns any error a handler returns into an *Error.
+func From(err error) *Error {
+	switch err := err.(type) {
+	case *Error:
+		return err
+	case ValidationErrors:
+		return Invalid(err...)
+	case *echo.HTTPError:
+		// these come from echo itself, mostly from routing and binding
+		switch err.Code {
+		case http.StatusBadRequest:
+			return BadRequest("invalid_params")
+		case http.StatusNotFound:
+			return NotFound("not_found")
+		case http.StatusMethodNotAllowed:
+			return New(http.StatusMethodNotAllowed, "method_not_allowed")
+		case http.StatusRequestEntityTooLarge:
+			return New(http.StatusRequestEntityTooLarge, "request_too_large")
+		case http.StatusUnsupportedMediaType:
+			return New(http.StatusUnsupportedMediaType, "unsupported_media_type")
+		case http.StatusUnauthorized:
+			return Unauthorized("logged_out")
+		}
+	}
+	return Internal("handling request", err)
+}
+
+// Handler is echo's HTTPErrorHandler. It sends every error as a Response with the request id, so it can be found in
+// the logs.
+func Handler(err error, c echo.Context) {
+	e := From(err)
+	logger := logging.FromContext(c)
+
+	if e.Status >= http.StatusInternalServerError {
+		logger.Error(e.message, e.err)
+	}
+
+	if info, ok := Codes[e.Code]; !ok || info.Status != e.Status {
+		logger.Warn("error code doesn't match its documentation", logging.Fields{"code": e.Code, "status": e.Status})
+	}
+
+	if c.Response().Committed {
+		// too late, the handler already started its own response
+		return
+	}
+
+	requestId := c.Response().Header().Get(echo.HeaderXRequestID)
+	if requestId == "" {
+		requestId = c.Request().Header.Get(echo.HeaderXRequestID)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(e.Status)
+	} else {
+		err = c.JSON(e.Status, Response{"error", e.Code, e.Fields, requestId})
+	}
+	if err != nil {
+		logger.Error("sending error response", err)
+	}
+}
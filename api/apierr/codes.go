@@ -0,0 +1,76 @@
+package apierr
+
+import "net/http"
+
+// CodeInfo documents an error code.
+type CodeInfo struct {
+	Status      int
+	Description string
+}
+
+// Codes lists every error code the API responds with. Clients rely on these, so once a code is in use it shouldn't
+// change, and it should always come with the same status.
+var Codes = map[string]CodeInfo{
+	"internal_server_error":  {http.StatusInternalServerError, "Something went wrong on the server."},
+	"invalid_params":         {http.StatusBadRequest, "A parameter is missing or invalid. If the problem is with specific fields, they're listed in fields."},
+	"missing_params":         {http.StatusBadRequest, "A required parameter is missing."},
+	"unsupported_media_type": {http.StatusUnsupportedMediaType, "The body isn't JSON, url-encoded or multipart."},
+	"not_found":              {http.StatusNotFound, "There's nothing at this path."},
+	"method_not_allowed":     {http.StatusMethodNotAllowed, "The path doesn't support this method."},
+	"request_too_large":      {http.StatusRequestEntityTooLarge, "The request body is too large."},
+	"rate_limited":           {http.StatusTooManyRequests, "Too many requests. Try again after the number of seconds in Retry-After."},
+
+	"unauthorized":       {http.StatusForbidden, "You aren't allowed to do this."},
+	"csrf_token_invalid": {http.StatusForbidden, "The X-CSRF-Token header is missing or doesn't match the session."},
+	"logged_out":         {http.StatusUnauthorized, "You need to be logged in."},
+	"invalid_login":      {http.StatusUnauthorized, "The email or password is wrong."},
+	"no_reset_available": {http.StatusUnauthorized, "The password reset link is invalid or has expired."},
+	"invalid_email":      {http.StatusBadRequest, "The email address isn't valid. The field is listed in fields."},
+	"insecure_password":  {http.StatusBadRequest, "The password is too short or too simple. The field is listed in fields."},
+	"account_exists":     {http.StatusBadRequest, "An account with that email already exists."},
+	"email_not_found":    {http.StatusNotFound, "No account has that email."},
+
+	"school_not_found":          {http.StatusNotFound, "The school you're registering with doesn't exist."},
+	"school_unverified":         {http.StatusForbidden, "The school hasn't been verified yet."},
+	"invalid_school":            {http.StatusNotFound, "The school doesn't exist."},
+	"display_name_already_used": {http.StatusConflict, "Another school has, or used to have, that display name."},
+	"search_query_too_short":    {http.StatusBadRequest, "Search queries need at least 3 characters."},
+	"invalid_club_head":         {http.StatusBadRequest, "The club head has to be a member of the school."},
+
+	"post_not_found":  {http.StatusNotFound, "The post doesn't exist."},
+	"event_not_found": {http.StatusNotFound, "The event doesn't exist."},
+
+	"invalid_attachment":    {http.StatusBadRequest, "The attachment doesn't exist or isn't yours."},
+	"logo_not_image":        {http.StatusBadRequest, "Logos have to be images."},
+	"attachment_not_found":  {http.StatusNotFound, "The attachment doesn't exist."},
+	"file_too_large":        {http.StatusRequestEntityTooLarge, "The file is too large."},
+	"unsupported_file_type": {http.StatusUnsupportedMediaType, "Files of that type can't be uploaded."},
+
+	"invalid_invite":       {http.StatusNotFound, "The invite doesn't exist, has expired or has been used up."},
+	"invite_for_students":  {http.StatusBadRequest, "The invite is for students, not teachers."},
+	"already_member":       {http.StatusConflict, "You're already a member of the school."},
+	"leads_another_school": {http.StatusConflict, "You lead another school, so you can't join this one."},
+	"membership_not_found": {http.StatusNotFound, "The user isn't a member of, or waiting to join, your school."},
+	"cannot_remove_leader": {http.StatusBadRequest, "The club head and faculty adviser can't be removed."},
+	"invalid_csv":          {http.StatusBadRequest, "The file isn't a CSV file with the expected columns."},
+	"too_many_rows":        {http.StatusRequestEntityTooLarge, "The file has too many rows to import at once."},
+	"not_a_member":         {http.StatusBadRequest, "The user isn't a member of your school."},
+	"user_is_club_head":    {http.StatusBadRequest, "The club head can't also have an officer role."},
+
+	"invalid_nominee":       {http.StatusBadRequest, "The nominee isn't a teacher who can become faculty adviser."},
+	"no_transfer_available": {http.StatusNotFound, "There's no pending adviser transfer to you with that key, or the school has changed hands since."},
+	"adviser_changed":       {http.StatusConflict, "The school's faculty adviser changed while you were making the change. Try again."},
+
+	"donation_not_found":      {http.StatusNotFound, "The donation doesn't exist."},
+	"donation_already_voided": {http.StatusConflict, "The donation has already been voided."},
+	"campaign_not_found":      {http.StatusNotFound, "The campaign doesn't exist."},
+
+	"requested_body_is_short_and_stout": {http.StatusTeapot, "I'm a teapot."},
+}
+
+// FieldCodes lists the codes a FieldError can have.
+var FieldCodes = []string{
+	"required", "invalid_email", "insecure_password", "invalid_url", "invalid_state", "invalid_characters",
+	"invalid_date", "before_start", "too_short", "too_long", "out_of_range", "invalid_choice", "invalid_number",
+	"invalid_boolean", "display_name_already_used",
+}
@@ -0,0 +1,86 @@
+package apierr
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+var codePattern = regexp.MustCompile(`^[a-z]+(_[a-z]+)*$`)
+
+// loginCodes are the only codes that respond with 401. Anything else a logged in user can't do is a 403.
+var loginCodes = map[string]bool{
+	"logged_out":         true,
+	"invalid_login":      true,
+	"no_reset_available": true,
+}
+
+func TestCodes(t *testing.T) {
+	descriptions := map[string]string{}
+
+	for code, info := range Codes {
+		if !codePattern.MatchString(code) {
+			t.Errorf("%s isn't snake_case", code)
+		}
+		if info.Status < 400 || info.Status > 599 || http.StatusText(info.Status) == "" {
+			t.Errorf("%s has status %d, which isn't an error status", code, info.Status)
+		}
+		if info.Status == http.StatusUnauthorized && !loginCodes[code] {
+			t.Errorf("%s responds with 401, but only logging in can fix that; use 403", code)
+		}
+		if info.Description == "" {
+			t.Errorf("%s has no description", code)
+		}
+		if other, ok := descriptions[info.Description]; ok {
+			t.Errorf("%s and %s have the same description", code, other)
+		}
+		descriptions[info.Description] = code
+	}
+
+	for code := range loginCodes {
+		if Codes[code].Status != http.StatusUnauthorized {
+			t.Errorf("%s should respond with 401", code)
+		}
+	}
+}
+
+func TestFieldCodes(t *testing.T) {
+	seen := map[string]bool{}
+	for _, code := range FieldCodes {
+		if !codePattern.MatchString(code) {
+			t.Errorf("%s isn't snake_case", code)
+		}
+		if seen[code] {
+			t.Errorf("%s is listed twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestFromMatchesCodes(t *testing.T) {
+	errs := []error{
+		errors.New("something broke"),
+		ValidationErrors{Field("email", "invalid_email")},
+		ValidationErrors{Field("name", "required")},
+	}
+	for status := 400; status < 600; status++ {
+		if http.StatusText(status) != "" {
+			errs = append(errs, echo.NewHTTPError(status))
+		}
+	}
+
+	for _, err := range errs {
+		e := From(err)
+		info, ok := Codes[e.Code]
+		if !ok {
+			t.Errorf("From(%v) has code %s, which isn't in Codes", err, e.Code)
+			continue
+		}
+		if info.Status != e.Status {
+			t.Errorf("From(%v) responds with %s and %d, but Codes says %d", err, e.Code, e.Status, info.Status)
+		}
+	}
+}
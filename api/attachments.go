@@ -0,0 +1,328 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/storage"
+	"github.com/whiskeybrav/studentclubportal-server/util"
+)
+
+const defaultMaxUploadSize = 10 << 20
+
+// maxUploadSize is how large an uploaded file can be.
+func maxUploadSize() int64 {
+	if config.Storage.MaxUploadSize <= 0 {
+		return defaultMaxUploadSize
+	}
+	return config.Storage.MaxUploadSize
+}
+
+// allowedUploadTypes are the MIME types that can be uploaded, as detected from the file's contents rather than what the
+// client claims.
+var allowedUploadTypes = map[string]bool{
+	"image/png":                 true,
+	"image/jpeg":                true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"application/pdf":           true,
+	"text/plain; charset=utf-8": true,
+}
+
+type Attachment struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url"`
+}
+
+type AttachmentResponse struct {
+	Status     string     `json:"status"`
+	Attachment Attachment `json:"attachment"`
+}
+
+func attachmentURL(id int) string {
+	return "/attachments/" + strconv.Itoa(id)
+}
+
+func isImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// parseAttachmentIds parses a comma separated list of attachment ids, as sent by the frontend. Each id is only
+// returned once, even if it's repeated.
+func parseAttachmentIds(s string) ([]int, error) {
+	var ids []int
+	if s == "" {
+		return ids, nil
+	}
+	seen := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// addAttachments links attachments to an item through the given join table, which is either postAttachments or
+// eventAttachments, as part of the transaction that adds the item.
+func addAttachments(tx *sql.Tx, joinTable string, joinColumn string, itemId int64, ids []int) error {
+	for _, id := range ids {
+		_, err := tx.Exec("INSERT INTO "+joinTable+" ("+joinColumn+", attachmentId) VALUES (?, ?)", itemId, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contentDisposition is a Content-Disposition header for a download with the given filename, encoded as RFC 6266
+// says so that any filename works.
+func contentDisposition(disposition string, filename string) string {
+	header := mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+	if header == "" {
+		// only happens for filenames mime can't encode at all, and the download still works without one
+		return disposition
+	}
+	return header
+}
+
+// attachmentsBelongToSchool checks that every given attachment was uploaded to the given school.
+func attachmentsBelongToSchool(ids []int, schoolId int) (bool, error) {
+	for _, id := range ids {
+		var attachmentSchoolId int
+		err := db.QueryRow("SELECT schoolId FROM attachments WHERE id = ?", id).Scan(&attachmentSchoolId)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if attachmentSchoolId != schoolId {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// getAttachments returns the attachments linked to an item through the given join table, which is either
+// postAttachments or eventAttachments.
+func getAttachments(joinTable string, joinColumn string, itemId int) ([]Attachment, error) {
+	rows, err := db.Query("SELECT a.id, a.filename, a.mimeType, a.size FROM attachments a INNER JOIN "+joinTable+" j ON j.attachmentId = a.id WHERE j."+joinColumn+" = ?", itemId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	attachments := []Attachment{}
+
+	for rows.Next() {
+		attachment := Attachment{}
+		err := rows.Scan(&attachment.ID, &attachment.Filename, &attachment.MimeType, &attachment.Size)
+		if err != nil {
+			return nil, err
+		}
+		attachment.URL = attachmentURL(attachment.ID)
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+func ConfigureAttachments(e *router) {
+	e.POST("/attachments/upload", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionPost, PermissionManageEvents)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return apierr.BadRequest("invalid_params")
+		}
+
+		if fileHeader.Size > maxUploadSize() {
+			return apierr.New(http.StatusRequestEntityTooLarge, "file_too_large")
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			return apierr.Internal("opening uploaded file", err)
+		}
+
+		defer file.Close()
+
+		// http.DetectContentType only ever looks at the first 512 bytes
+		head := make([]byte, 512)
+		n, err := io.ReadFull(file, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return apierr.Internal("reading uploaded file", err)
+		}
+		head = head[:n]
+
+		mimeType := http.DetectContentType(head)
+		if !allowedUploadTypes[mimeType] {
+			return apierr.New(http.StatusUnsupportedMediaType, "unsupported_file_type")
+		}
+
+		key, err := util.GenerateRandomString(24)
+		if err != nil {
+			return apierr.Internal("generating storage key", err)
+		}
+
+		err = storage.Store.Put(key, io.MultiReader(bytes.NewReader(head), file))
+		if err != nil {
+			return apierr.Internal("storing uploaded file", err)
+		}
+
+		filename := filepath.Base(fileHeader.Filename)
+
+		result, err := db.Exec("INSERT INTO attachments (schoolId, uploaderId, storageKey, filename, mimeType, size, created) VALUES (?, ?, ?, ?, ?, ?, NOW())", schoolId, session.UserID, key, filename, mimeType, fileHeader.Size)
+		if err != nil {
+			_ = storage.Store.Delete(key)
+			return apierr.Internal("adding attachment", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return apierr.Internal("getting id of new attachment", err)
+		}
+
+		return c.JSON(http.StatusOK, AttachmentResponse{"ok", Attachment{
+			ID:       int(id),
+			Filename: filename,
+			MimeType: mimeType,
+			Size:     fileHeader.Size,
+			URL:      attachmentURL(int(id)),
+		}})
+	})
+
+	e.GET("/attachments/:id", func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return apierr.BadRequest("invalid_params")
+		}
+
+		var schoolId int
+		var key, filename, mimeType string
+
+		err = db.QueryRow("SELECT schoolId, storageKey, filename, mimeType FROM attachments WHERE id = ?", id).Scan(&schoolId, &key, &filename, &mimeType)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("attachment_not_found")
+		}
+		if err != nil {
+			return apierr.Internal("getting attachment", err)
+		}
+
+		allowed, err := canViewSchool(schoolId, authentication.GetSession(c).UserID)
+		if err != nil {
+			return apierr.Internal("checking if school can be viewed", err)
+		}
+		if !allowed {
+			// the same as a missing attachment, so ids can't be used to find out about unverified schools
+			return apierr.NotFound("attachment_not_found")
+		}
+
+		file, err := storage.Store.Open(key)
+		if err != nil {
+			return apierr.Internal("opening attachment", err)
+		}
+
+		defer file.Close()
+
+		disposition := "attachment"
+		if isImage(mimeType) {
+			disposition = "inline"
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, contentDisposition(disposition, filename))
+		c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+
+		return c.Stream(http.StatusOK, mimeType, file)
+	})
+
+	e.POST("/attachments/delete", func(c echo.Context) error {
+		request := idRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		id := request.ID
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionPost, PermissionManageEvents)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		var attachmentSchoolId int
+		var key string
+
+		err = db.QueryRow("SELECT schoolId, storageKey FROM attachments WHERE id = ?", id).Scan(&attachmentSchoolId, &key)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("attachment_not_found")
+		}
+		if err != nil {
+			return apierr.Internal("getting attachment to delete", err)
+		}
+
+		if schoolId != attachmentSchoolId {
+			return forbidden(c)
+		}
+
+		_, err = db.Exec("DELETE FROM postAttachments WHERE attachmentId = ?", id)
+		if err != nil {
+			return apierr.Internal("unlinking attachment from posts", err)
+		}
+
+		_, err = db.Exec("DELETE FROM eventAttachments WHERE attachmentId = ?", id)
+		if err != nil {
+			return apierr.Internal("unlinking attachment from events", err)
+		}
+
+		_, err = db.Exec("UPDATE schools SET logoId = NULL WHERE logoId = ?", id)
+		if err != nil {
+			return apierr.Internal("unlinking attachment from school logo", err)
+		}
+
+		_, err = db.Exec("DELETE FROM attachments WHERE id = ?", id)
+		if err != nil {
+			return apierr.Internal("deleting attachment", err)
+		}
+
+		err = storage.Store.Delete(key)
+		if err != nil {
+			// the database no longer references the file, so this only leaves an orphan on disk
+			logging.FromContext(c).Error("deleting attachment file (nonfatal)", err)
+		}
+
+		return statusOk(c)
+	})
+}
@@ -1,15 +1,17 @@
 package api
 
 import (
+	"database/sql"
 	"github.com/NoteToScreen/maily-go/maily"
 	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
 	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
-	"github.com/whiskeybrav/studentclubportal-server/errlog"
 	"github.com/whiskeybrav/studentclubportal-server/mail"
+	"github.com/whiskeybrav/studentclubportal-server/metrics"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
 	"github.com/whiskeybrav/studentclubportal-server/util"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
-	"strconv"
 )
 
 const (
@@ -17,6 +19,18 @@ const (
 	UserTypeStudent
 )
 
+const (
+	UserLevelMember = iota
+	UserLevelAdmin
+)
+
+// isAdmin checks whether the user is a site administrator.
+func isAdmin(userId int) bool {
+	userLevel := 0
+	err := db.QueryRow("SELECT userLevel FROM users WHERE id = ?", userId).Scan(&userLevel)
+	return err == nil && userLevel >= UserLevelAdmin
+}
+
 type me struct {
 	Id            int    `json:"id"`
 	Fname         string `json:"fname"`
@@ -31,6 +45,12 @@ type me struct {
 	HowDidYouHear string `json:"how_did_you_hear"`
 	UserLevel     int    `json:"user_level"`
 	Registration  string `json:"registration"`
+
+	// the school fields are for the school the user registered for or last joined, which they're only a member of if
+	// this is active
+	MembershipStatus string `json:"membership_status"`
+
+	NotificationPreferences notifications.Preferences `json:"notification_preferences"`
 }
 
 type MeResponse struct {
@@ -43,169 +63,224 @@ type LoginResponse struct {
 	School string `json:"school"`
 }
 
-func ConfigureAuth(e *echo.Echo) {
+type registerTeacherRequest struct {
+	FirstName  string `json:"fname" form:"fname" validate:"required,max=255"`
+	LastName   string `json:"lname" form:"lname" validate:"required,max=255"`
+	Email      string `json:"email" form:"email" validate:"required,email"`
+	Password   string `json:"password" form:"password" validate:"required,password"`
+	SchoolID   int    `json:"schoolId" form:"schoolId"`
+	InviteCode string `json:"inviteCode" form:"inviteCode"`
+}
+
+type registerStudentRequest struct {
+	FirstName     string `json:"fname" form:"fname" validate:"required,max=255"`
+	LastName      string `json:"lname" form:"lname" validate:"required,max=255"`
+	Email         string `json:"email" form:"email" validate:"required,email"`
+	Password      string `json:"password" form:"password" validate:"required,password"`
+	SchoolID      int    `json:"schoolId" form:"schoolId"`
+	InviteCode    string `json:"inviteCode" form:"inviteCode"`
+	ShowsLastName bool   `json:"showsLastName" form:"showsLastName"`
+	GradeLevel    int    `json:"gradeLevel" form:"gradeLevel" validate:"required,min=1,max=12"`
+	HowDidYouHear string `json:"howDidYouHear" form:"howDidYouHear" validate:"required"`
+}
+
+type loginRequest struct {
+	Email    string `json:"email" form:"email" validate:"required"`
+	Password string `json:"password" form:"password" validate:"required"`
+}
+
+type requestPasswordResetRequest struct {
+	Email string `json:"email" form:"email" validate:"required"`
+}
+
+type resetPasswordRequest struct {
+	Key      string `json:"key" form:"key" validate:"required"`
+	Password string `json:"password" form:"password" validate:"required,password"`
+}
+
+func ConfigureAuth(e *router) {
 	e.POST("/auth/registerTeacher", func(c echo.Context) error {
-		if c.FormValue("fname") == "" || c.FormValue("lname") == "" || c.FormValue("email") == "" || c.FormValue("password") == "" || c.FormValue("schoolId") == "" {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+		request := registerTeacherRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		if request.SchoolID == 0 && request.InviteCode == "" {
+			return apierr.Invalid(apierr.Field("schoolId", "required"))
 		}
 
-		if !util.EmailIsValid(c.FormValue("email")) {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_email"})
+		schoolId, invite, err := registrationSchool(request.SchoolID, request.InviteCode)
+		if err == errInviteInvalid {
+			return apierr.NotFound("invalid_invite")
+		}
+		if err != nil {
+			return apierr.Internal("finding invite", err)
 		}
 
-		if !authentication.ValidatePassword(c.FormValue("password")) {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "insecure_password"})
+		if invite != nil && invite.Role == InviteRoleClubHead {
+			return apierr.BadRequest("invite_for_students")
 		}
 
 		empty := ""
 
-		acctExistsErr := db.QueryRow("SELECT id FROM users WHERE email = ?", c.FormValue("email")).Scan(&empty)
+		acctExistsErr := db.QueryRow("SELECT id FROM users WHERE email = ?", request.Email).Scan(&empty)
 
 		if acctExistsErr == nil {
 			// the account already exists
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "account_exists"})
+			return apierr.BadRequest("account_exists")
 		}
 
-		err := db.QueryRow("SELECT displayname FROM schools WHERE id = ?", c.FormValue("schoolId")).Scan(&empty)
+		err = db.QueryRow("SELECT displayname FROM schools WHERE id = ?", schoolId).Scan(&empty)
 
 		if err != nil {
 			// the school doesn't exist
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "school_not_found"})
+			return apierr.NotFound("school_not_found")
 		}
 
-		pwd, err := bcrypt.GenerateFromPassword([]byte(c.FormValue("password")), bcrypt.DefaultCost)
+		pwd, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
 		if err != nil {
-			errlog.LogError("generating password hash", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("generating password hash", err)
 		}
 
-		_, err = db.Exec("INSERT INTO users (fname, lname, email, password, schoolId, type, userLevel, registration) VALUES (?, ?, ?, ?, ?, ?, 0, NOW())", c.FormValue("fname"), c.FormValue("lname"), c.FormValue("email"), string(pwd), c.FormValue("schoolId"), UserTypeTeacher)
+		_, err = db.Exec("INSERT INTO users (fname, lname, email, password, schoolId, type, userLevel, registration) VALUES (?, ?, ?, ?, ?, ?, 0, NOW())", request.FirstName, request.LastName, request.Email, string(pwd), schoolId, UserTypeTeacher)
 		if err != nil {
-			errlog.LogError("adding user to db", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("adding user to db", err)
 		}
 
+		metrics.Registered("teacher")
+
 		session := c.Get("session").(authentication.SessionInfo)
 
-		err = db.QueryRow("SELECT id FROM users WHERE email = ?", c.FormValue("email")).Scan(&session.UserID)
+		err = db.QueryRow("SELECT id FROM users WHERE email = ?", request.Email).Scan(&session.UserID)
 		if err != nil {
-			errlog.LogError("getting new user id from DB", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting new user id from DB", err)
 		}
 
 		err = authentication.SetSession(session)
 		if err != nil {
-			errlog.LogError("getting new user id from DB", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting new user id from DB", err)
+		}
+
+		err = joinAfterRegistration(session.UserID, schoolId, invite)
+		if err != nil {
+			return apierr.Internal("adding membership", err)
 		}
 
 		return statusOk(c)
 	})
 
 	e.POST("/auth/registerStudent", func(c echo.Context) error {
-		if c.FormValue("fname") == "" || c.FormValue("lname") == "" || c.FormValue("email") == "" || c.FormValue("password") == "" || c.FormValue("schoolId") == "" || c.FormValue("gradeLevel") == "" || c.FormValue("howDidYouHear") == "" {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
-		}
-
-		gradeLevel, err := strconv.Atoi(c.FormValue("gradeLevel"))
-		if err != nil || (gradeLevel < 1 || gradeLevel > 12) {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+		request := registerStudentRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
 		}
 
-		if c.FormValue("showsLastName") != "true" && c.FormValue("showsLastName") != "false" {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+		if request.SchoolID == 0 && request.InviteCode == "" {
+			return apierr.Invalid(apierr.Field("schoolId", "required"))
 		}
 
-		if !util.EmailIsValid(c.FormValue("email")) {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_email"})
+		schoolId, invite, err := registrationSchool(request.SchoolID, request.InviteCode)
+		if err == errInviteInvalid {
+			return apierr.NotFound("invalid_invite")
 		}
-
-		if !authentication.ValidatePassword(c.FormValue("password")) {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "insecure_password"})
+		if err != nil {
+			return apierr.Internal("finding invite", err)
 		}
 
 		empty := ""
 
-		acctExistsErr := db.QueryRow("SELECT id FROM users WHERE email = ?", c.FormValue("email")).Scan(&empty)
+		acctExistsErr := db.QueryRow("SELECT id FROM users WHERE email = ?", request.Email).Scan(&empty)
 
 		if acctExistsErr == nil {
 			// the account already exists
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "account_exists"})
+			return apierr.BadRequest("account_exists")
 		}
 
-		err = db.QueryRow("SELECT displayname FROM schools WHERE id = ?", c.FormValue("schoolId")).Scan(&empty)
+		err = db.QueryRow("SELECT displayname FROM schools WHERE id = ?", schoolId).Scan(&empty)
 
 		if err != nil {
 			// the school doesn't exist
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "school_not_found"})
+			return apierr.NotFound("school_not_found")
 		}
 
-		pwd, err := bcrypt.GenerateFromPassword([]byte(c.FormValue("password")), bcrypt.DefaultCost)
+		pwd, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
 		if err != nil {
-			errlog.LogError("generating password hash", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("generating password hash", err)
 		}
 
 		_, err = db.Exec("INSERT INTO users (fname, showsLastname, lname, email, password, schoolId, type, userLevel, gradeLevel, howDidYouHear, registration) VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?, NOW())",
-			c.FormValue("fname"),
-			c.FormValue("showsLastName") == "true",
-			c.FormValue("lname"),
-			c.FormValue("email"),
+			request.FirstName,
+			request.ShowsLastName,
+			request.LastName,
+			request.Email,
 			string(pwd),
-			c.FormValue("schoolId"),
+			schoolId,
 			UserTypeStudent,
-			gradeLevel,
-			c.FormValue("howDidYouHear"),
+			request.GradeLevel,
+			request.HowDidYouHear,
 		)
 		if err != nil {
-			errlog.LogError("adding user to db", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("adding user to db", err)
 		}
 
+		metrics.Registered("student")
+
 		session := c.Get("session").(authentication.SessionInfo)
 
-		err = db.QueryRow("SELECT id FROM users WHERE email = ?", c.FormValue("email")).Scan(&session.UserID)
+		err = db.QueryRow("SELECT id FROM users WHERE email = ?", request.Email).Scan(&session.UserID)
 		if err != nil {
-			errlog.LogError("getting new user id from DB", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting new user id from DB", err)
 		}
 
 		err = authentication.SetSession(session)
 		if err != nil {
-			errlog.LogError("getting new user id from DB #2", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting new user id from DB #2", err)
+		}
+
+		err = joinAfterRegistration(session.UserID, schoolId, invite)
+		if err != nil {
+			return apierr.Internal("adding membership", err)
 		}
 
 		return statusOk(c)
 	})
 
 	e.POST("/auth/login", func(c echo.Context) error {
-		if c.FormValue("email") == "" || c.FormValue("password") == "" {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+		request := loginRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
 		}
 
-		email := c.FormValue("email")
-		password := c.FormValue("password")
+		email := request.Email
+		password := request.Password
 
 		passwordHash := ""
 		id := -1
 		schoolDisplayName := ""
 
-		err := db.QueryRow("SELECT u.password, u.id,  s.displayname FROM users u INNER JOIN schools s ON u.schoolId = s.id WHERE email = ?", email).Scan(&passwordHash, &id, &schoolDisplayName)
+		// the school is only sent to active members, since it's where the frontend takes them after logging in. Anyone
+		// else sees their membership status in /auth/me instead.
+		err = db.QueryRow("SELECT u.password, u.id, COALESCE(s.displayname, '') FROM users u LEFT OUTER JOIN memberships m ON m.userId = u.id AND m.schoolId = u.schoolId AND m.status = ? LEFT OUTER JOIN schools s ON m.schoolId = s.id WHERE email = ?", MembershipActive, email).Scan(&passwordHash, &id, &schoolDisplayName)
+		if err == sql.ErrNoRows {
+			return apierr.Unauthorized("invalid_login")
+		}
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "invalid_login"})
+			return apierr.Internal("getting user to log in", err)
 		}
 
 		err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password))
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "invalid_login"})
+			return apierr.Unauthorized("invalid_login")
 		}
 
 		session := authentication.GetSession(c)
 		session.UserID = id
 		err = authentication.SetSession(session)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("saving session", err)
 		}
 
 		return c.JSON(http.StatusOK, LoginResponse{"ok", schoolDisplayName})
@@ -213,7 +288,7 @@ func ConfigureAuth(e *echo.Echo) {
 
 	e.POST("/auth/logout", func(c echo.Context) error {
 		if c.Get("session").(authentication.SessionInfo).UserID == -1 {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "logged_out"})
+			return apierr.Unauthorized("logged_out")
 		}
 
 		session := authentication.GetSession(c)
@@ -222,8 +297,7 @@ func ConfigureAuth(e *echo.Echo) {
 
 		err := authentication.SetSession(session)
 		if err != nil {
-			errlog.LogError("logging user out", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("logging user out", err)
 		}
 
 		return statusOk(c)
@@ -234,7 +308,7 @@ func ConfigureAuth(e *echo.Echo) {
 		uid := session.UserID
 
 		if uid == -1 {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "logged_out"})
+			return apierr.Unauthorized("logged_out")
 		}
 
 		me := me{}
@@ -256,83 +330,93 @@ func ConfigureAuth(e *echo.Echo) {
 		)
 
 		if err != nil {
-			errlog.LogError("getting user info", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting user info", err)
 		}
 
 		me.ShowsLastName = showsLastNameInt == 1
 		me.Id = uid
 
+		me.MembershipStatus, err = getMembershipStatus(uid, me.SchoolId)
+		if err != nil {
+			return apierr.Internal("getting membership status", err)
+		}
+
+		me.NotificationPreferences, err = notifications.GetPreferences(uid)
+		if err != nil {
+			return apierr.Internal("getting notification preferences", err)
+		}
+
 		return c.JSON(http.StatusOK, MeResponse{"ok", me})
 	})
 
 	e.POST("/auth/requestPasswordReset", func(c echo.Context) error {
-		if c.FormValue("email") == "" {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "missing_params"})
+		request := requestPasswordResetRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
 		}
 
 		fname := ""
 		lname := ""
 		id := ""
 
-		err := db.QueryRow("SELECT fname, lname, id FROM users WHERE email = ?", c.FormValue("email")).Scan(&fname, &lname, &id)
+		err = db.QueryRow("SELECT fname, lname, id FROM users WHERE email = ?", request.Email).Scan(&fname, &lname, &id)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("email_not_found")
+		}
 		if err != nil {
-			return c.JSON(http.StatusNotFound, ErrorResponse{"error", "email_not_found"})
+			return apierr.Internal("getting user to reset password", err)
 		}
 
-		key, err := authentication.GenerateRandomString(26)
+		key, err := util.GenerateRandomString(26)
 		if err != nil {
-			errlog.LogError("generating password reset key", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("generating password reset key", err)
 		}
 
 		_, err = db.Exec("INSERT INTO passwordResets (userId, `key`, expiry) VALUES (?, ?, ADDDATE(NOW(), INTERVAL 1 DAY))", id, key)
 		if err != nil {
-			errlog.LogError("adding password reset", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("adding password reset", err)
 		}
 
-		_, err = mail.Mail.SendMail(fname+" "+lname, c.FormValue("email"), "passwordReset", maily.TemplateData{
+		err = mail.Send(fname+" "+lname, request.Email, "passwordReset", maily.TemplateData{
 			"fname": fname,
 			"key":   key,
-		}, maily.FuncMap{}, maily.FuncMap{})
+		})
 		if err != nil {
-			errlog.LogError("sending mail", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("sending mail", err)
 		}
 
 		return c.JSON(http.StatusOK, StatusResponse{"ok"})
 	})
 
 	e.POST("/auth/resetPassword", func(c echo.Context) error {
-		if c.FormValue("password") == "" || c.FormValue("key") == "" {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "missing_params"})
-		}
-
-		if !authentication.ValidatePassword(c.FormValue("password")) {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "insecure_password"})
+		request := resetPasswordRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
 		}
 
 		userId := 0
 
-		err := db.QueryRow("SELECT userId FROM passwordResets WHERE `key` = ? AND expiry > NOW() AND used != 1", c.FormValue("key")).Scan(&userId)
+		err = db.QueryRow("SELECT userId FROM passwordResets WHERE `key` = ? AND expiry > NOW() AND used != 1", request.Key).Scan(&userId)
+		if err == sql.ErrNoRows {
+			return apierr.Unauthorized("no_reset_available")
+		}
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "no_reset_available"})
+			return apierr.Internal("getting password reset", err)
 		}
 
-		hashedPw, err := bcrypt.GenerateFromPassword([]byte(c.FormValue("password")), bcrypt.DefaultCost)
+		hashedPw, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
 		if err != nil {
-			errlog.LogError("hashing new password", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("hashing new password", err)
 		}
 
 		_, err = db.Exec("UPDATE users SET password = ? WHERE id = ?", hashedPw, userId)
 		if err != nil {
-			errlog.LogError("setting new password", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("setting new password", err)
 		}
 
-		_, _ = db.Exec("UPDATE passwordResets SET used = 1 WHERE `key` = ?", c.FormValue("key"))
+		_, _ = db.Exec("UPDATE passwordResets SET used = 1 WHERE `key` = ?", request.Key)
 		// if this fails who cares
 
 		return c.JSON(http.StatusOK, StatusResponse{"ok"})
@@ -0,0 +1,59 @@
+package authentication
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+)
+
+// HeaderCSRFToken carries the CSRF token. Every response with a session has it, and state-changing requests have to
+// send it back. A cross-site form can't set headers, and a cross-site script can't read them without being allowed by
+// CORS, so only the frontend can.
+const HeaderCSRFToken = "X-CSRF-Token"
+
+// csrfToken is the token for a session. It's derived from the session token, so it doesn't need to be stored, and it
+// can't be worked out without the secret.
+func csrfToken(secret []byte, sessionToken string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(sessionToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// changesState reports whether a request can change something, and so needs a CSRF token.
+func changesState(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+// checkCSRFToken makes sure a state-changing request came with the session's CSRF token.
+func checkCSRFToken(c echo.Context, token string) error {
+	if !changesState(c.Request().Method) {
+		return nil
+	}
+
+	sent := c.Request().Header.Get(HeaderCSRFToken)
+	if sent == "" || !hmac.Equal([]byte(sent), []byte(token)) {
+		return apierr.New(http.StatusForbidden, "csrf_token_invalid")
+	}
+	return nil
+}
+
+// ParseSameSite turns a config value, lax, strict or none, into the cookie setting.
+func ParseSameSite(sameSite string) http.SameSite {
+	switch sameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	case "lax":
+		return http.SameSiteLaxMode
+	}
+	return http.SameSiteDefaultMode
+}
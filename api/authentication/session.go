@@ -1,41 +1,21 @@
 package authentication
 
 import (
-	"crypto/rand"
-	"encoding/base64"
-	"fmt"
 	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/util"
 	"net/http"
 	"time"
 )
 
-type ErrorResponse struct {
-	Status string `json:"status"`
-	Error  string `json:"error"`
-}
-
 type SessionInfo struct {
 	UserID int
 	Token  string
 }
 
-func GenerateRandomBytes(n int) ([]byte, error) {
-	b := make([]byte, n)
-	_, err := rand.Read(b)
-	if err != nil {
-		return nil, err
-	}
-
-	return b, nil
-}
-
-func GenerateRandomString(s int) (string, error) {
-	b, err := GenerateRandomBytes(s)
-	return base64.URLEncoding.EncodeToString(b), err
-}
-
 func GenerateSessionToken() (string, error) {
-	return GenerateRandomString(26)
+	return util.GenerateRandomString(26)
 }
 
 func GetSessionFromToken(token string) (SessionInfo, error) {
@@ -63,20 +43,71 @@ func SetSession(info SessionInfo) error {
 	return err
 }
 
+type SessionConfig struct {
+	// Skipper decides which requests don't need a session, like health checks, so they don't create one each time.
+	Skipper func(c echo.Context) bool
+
+	// CSRFSkipper decides which state-changing requests don't need a CSRF token, because they're authorized some other
+	// way, like one-click unsubscribe links.
+	CSRFSkipper func(c echo.Context) bool
+
+	// CSRFSecret signs CSRF tokens. If it's empty, a random one is made.
+	CSRFSecret []byte
+
+	// SameSite and Secure are set on new session cookies.
+	SameSite http.SameSite
+	Secure   bool
+}
+
+var DefaultSessionConfig = SessionConfig{
+	Skipper:     func(c echo.Context) bool { return false },
+	CSRFSkipper: func(c echo.Context) bool { return false },
+	SameSite:    http.SameSiteLaxMode,
+}
+
 func SessionMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return SessionMiddlewareWithConfig(DefaultSessionConfig)(next)
+}
+
+func SessionMiddlewareWithConfig(config SessionConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultSessionConfig.Skipper
+	}
+	if config.CSRFSkipper == nil {
+		config.CSRFSkipper = DefaultSessionConfig.CSRFSkipper
+	}
+	if len(config.CSRFSecret) == 0 {
+		secret, err := util.GenerateRandomBytes(32)
+		if err != nil {
+			panic("authentication: generating CSRF secret: " + err.Error())
+		}
+		config.CSRFSecret = secret
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return sessionHandler(config, next)
+	}
+}
+
+func sessionHandler(config SessionConfig, next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		if config.Skipper(c) {
+			return next(c)
+		}
+
+		var session SessionInfo
+
 		cookie, err := c.Cookie("token")
 		if err != nil {
 			// newToken doesn't exist
 			token, err := GenerateSessionToken()
 			if err != nil {
-				fmt.Println(err)
-				return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+				return apierr.Internal("generating session token", err)
 			}
-			err = SetSession(SessionInfo{-1, token})
+			session = SessionInfo{-1, token}
+			err = SetSession(session)
 			if err != nil {
-				fmt.Println(err)
-				return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+				return apierr.Internal("creating session", err)
 			}
 
 			newToken := new(http.Cookie)
@@ -84,23 +115,29 @@ func SessionMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			newToken.Value = token
 			newToken.Expires = time.Now().Add(24 * 7 * time.Hour)
 			newToken.HttpOnly = true
+			newToken.Secure = config.Secure
+			newToken.SameSite = config.SameSite
 			newToken.Path = "/"
 			c.SetCookie(newToken)
-
-			c.Set("session", SessionInfo{-1, token})
-
-			return next(c)
+		} else {
+			session, err = GetSessionFromToken(cookie.Value)
+			if err != nil {
+				return apierr.Internal("getting session", err)
+			}
 		}
 
-		token := cookie.Value
+		c.Set("session", session)
+		c.Set(logging.UserIDKey, session.UserID)
 
-		session, err := GetSessionFromToken(token)
-		if err != nil {
-			fmt.Println(err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
-		}
+		token := csrfToken(config.CSRFSecret, session.Token)
+		c.Response().Header().Set(HeaderCSRFToken, token)
 
-		c.Set("session", session)
+		if !config.CSRFSkipper(c) {
+			err = checkCSRFToken(c, token)
+			if err != nil {
+				return err
+			}
+		}
 
 		return next(c)
 	}
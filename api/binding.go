@@ -0,0 +1,266 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btubbs/datetime"
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/util"
+)
+
+// bind fills in a request struct from the query string and then from a JSON, url-encoded or multipart body, then
+// checks it against its validate tags. Fields are named by their form tag, and JSON bodies use the same names. The query
+// string is read for every method, like c.FormValue does, so clients that sent fields there keep working. Path
+// parameters of /v1 routes override anything sent with the same name. The error it returns is an *apierr.Error, so
+// handlers can return it as it is.
+func bind(c echo.Context, request interface{}) error {
+	req := c.Request()
+
+	query := map[string]string{}
+	for name, values := range c.QueryParams() {
+		query[name] = values[0]
+	}
+
+	errs := bindValues(request, query)
+	if len(errs) > 0 {
+		return apierr.Invalid(errs...)
+	}
+
+	// echo refuses empty bodies, but they should just fail validation like any other missing fields
+	if req.ContentLength != 0 && req.Method != http.MethodGet {
+		err := c.Bind(request)
+		if err == echo.ErrUnsupportedMediaType {
+			return apierr.New(http.StatusUnsupportedMediaType, "unsupported_media_type")
+		}
+		if err != nil {
+			return apierr.BadRequest("invalid_params")
+		}
+	}
+
+	if params, ok := c.Get(pathParamsKey).(map[string]string); ok {
+		errs := bindValues(request, params)
+		if len(errs) > 0 {
+			return apierr.Invalid(errs...)
+		}
+	}
+
+	errs = validate(request)
+	if len(errs) > 0 {
+		return apierr.Invalid(errs...)
+	}
+	return nil
+}
+
+// bindValues sets the fields of a request struct whose form names are in values. Fields that are pointers are set to
+// point to the value.
+func bindValues(request interface{}, values map[string]string) apierr.ValidationErrors {
+	var errs apierr.ValidationErrors
+
+	value := reflect.ValueOf(request).Elem()
+	structType := value.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+		name := structType.Field(i).Tag.Get("form")
+		param, ok := values[name]
+		if name == "" || !ok {
+			continue
+		}
+
+		field := value.Field(i)
+		if param == "" && field.Kind() != reflect.String {
+			// like echo does for form values, an empty value leaves the field as it is
+			continue
+		}
+
+		target := field
+		if field.Kind() == reflect.Ptr {
+			target = reflect.New(field.Type().Elem()).Elem()
+		}
+
+		switch target.Kind() {
+		case reflect.String:
+			target.SetString(param)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				errs = append(errs, apierr.Field(name, "invalid_number"))
+				continue
+			}
+			target.SetInt(n)
+		case reflect.Float64:
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				errs = append(errs, apierr.Field(name, "invalid_number"))
+				continue
+			}
+			target.SetFloat(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(param)
+			if err != nil {
+				errs = append(errs, apierr.Field(name, "invalid_boolean"))
+				continue
+			}
+			target.SetBool(b)
+		default:
+			panic("bind: values can't be bound to " + target.Kind().String())
+		}
+
+		if field.Kind() == reflect.Ptr {
+			field.Set(target.Addr())
+		}
+	}
+
+	return errs
+}
+
+// validate checks every field of a request struct against its validate tag, which is a comma separated list of rules:
+//
+//	required     must not be empty or zero
+//	email        must be an email address
+//	password     must be secure enough, see authentication.ValidatePassword
+//	url          must be an http or https URL
+//	state        must be a US state code
+//	letters      must only contain letters
+//	date         must be a YYYY-MM-DD date
+//	datetime     must be an ISO 8601 date and time
+//	min=n, max=n must be at least or at most n, or for strings, that many characters long
+//	oneof=a b c  must be one of the given values
+//
+// Rules other than required are skipped for empty fields, so optional fields can still be validated when present.
+// Pointer fields are only checked when they were sent, and then required means they can't be sent empty.
+func validate(request interface{}) apierr.ValidationErrors {
+	var errs apierr.ValidationErrors
+
+	value := reflect.ValueOf(request).Elem()
+	structType := value.Type()
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+
+		name := field.Tag.Get("form")
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldValue := value.Field(i)
+		if fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				continue
+			}
+			fieldValue = fieldValue.Elem()
+		}
+
+		problem := checkRules(fieldValue, rules)
+		if problem != "" {
+			errs = append(errs, apierr.Field(name, problem))
+		}
+	}
+
+	return errs
+}
+
+// checkRules returns the error code for the first rule the value breaks, or an empty string if it passes them all.
+func checkRules(value reflect.Value, rules string) string {
+	if value.IsZero() {
+		if strings.Contains(","+rules+",", ",required,") {
+			return "required"
+		}
+		return ""
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i != -1 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "required":
+		case "email":
+			if !util.EmailIsValid(value.String()) {
+				return "invalid_email"
+			}
+		case "password":
+			if !authentication.ValidatePassword(value.String()) {
+				return "insecure_password"
+			}
+		case "url":
+			if !util.URLIsValid(value.String()) {
+				return "invalid_url"
+			}
+		case "state":
+			if !util.StateIsValid(value.String()) {
+				return "invalid_state"
+			}
+		case "letters":
+			if !isLetter(value.String()) {
+				return "invalid_characters"
+			}
+		case "date":
+			if _, err := time.Parse("2006-01-02", value.String()); err != nil {
+				return "invalid_date"
+			}
+		case "datetime":
+			if _, err := datetime.ParseUTC(value.String()); err != nil {
+				return "invalid_date"
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic("validate: bad " + name + " limit " + strconv.Quote(arg))
+			}
+
+			n, isString := size(value)
+			if name == "min" && n < limit {
+				if isString {
+					return "too_short"
+				}
+				return "out_of_range"
+			}
+			if name == "max" && n > limit {
+				if isString {
+					return "too_long"
+				}
+				return "out_of_range"
+			}
+		case "oneof":
+			found := false
+			for _, option := range strings.Fields(arg) {
+				if value.String() == option {
+					found = true
+				}
+			}
+			if !found {
+				return "invalid_choice"
+			}
+		default:
+			panic("validate: unknown rule " + strconv.Quote(name))
+		}
+	}
+
+	return ""
+}
+
+// size is what min and max compare against: the length of strings in characters, or the value of numbers.
+func size(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(len([]rune(value.String()))), true
+	case reflect.Int, reflect.Int64:
+		return float64(value.Int()), false
+	case reflect.Float64:
+		return value.Float(), false
+	}
+	panic("validate: min and max don't work on " + value.Kind().String())
+}
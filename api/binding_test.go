@@ -0,0 +1,235 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+)
+
+func TestCheckRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		rules string
+		want  string
+	}{
+		{"required empty", "", "required", "required"},
+		{"required zero", 0, "required", "required"},
+		{"required set", "a", "required", ""},
+		{"optional empty skips rules", "", "email,max=1", ""},
+
+		{"email", "someone@example.com", "email", ""},
+		{"email invalid", "someone", "email", "invalid_email"},
+
+		{"password", "hunter22a", "password", ""},
+		{"password without digits", "hunterhunter", "password", "insecure_password"},
+		{"password too short", "abc123", "password", "insecure_password"},
+
+		{"url", "https://example.com/folder", "url", ""},
+		{"url without scheme", "example.com", "url", "invalid_url"},
+		{"url with other scheme", "ftp://example.com", "url", "invalid_url"},
+
+		{"state", "ca", "state", ""},
+		{"state invalid", "ZZ", "state", "invalid_state"},
+
+		{"letters", "élan", "letters", ""},
+		{"letters with digits", "club1", "letters", "invalid_characters"},
+
+		{"date", "2019-11-05", "date", ""},
+		{"date invalid", "11/05/2019", "date", "invalid_date"},
+
+		{"datetime", "2019-11-05T15:04:05Z", "datetime", ""},
+		{"datetime invalid", "tomorrow", "datetime", "invalid_date"},
+
+		{"min string", "ab", "min=2", ""},
+		{"min string too short", "a", "min=2", "too_short"},
+		{"min counts characters", "éé", "min=2,max=2", ""},
+		{"max string too long", "abc", "max=2", "too_long"},
+		{"min int", 1, "min=1", ""},
+		{"min int out of range", -1, "min=1", "out_of_range"},
+		{"max int out of range", 13, "max=12", "out_of_range"},
+		{"min float out of range", 0.001, "min=0.01", "out_of_range"},
+		{"max float", 99.5, "max=100", ""},
+
+		{"oneof", "card", "oneof=cash card", ""},
+		{"oneof invalid", "gold", "oneof=cash card", "invalid_choice"},
+
+		{"first broken rule wins", "x", "min=2,oneof=a b", "too_short"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := checkRules(reflect.ValueOf(test.value), test.rules)
+			if got != test.want {
+				t.Errorf("checkRules(%#v, %q) = %q, want %q", test.value, test.rules, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckRulesPanicsOnUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("checkRules didn't panic on an unknown rule")
+		}
+	}()
+	checkRules(reflect.ValueOf("a"), "shiny")
+}
+
+type bindTestRequest struct {
+	Name   string  `json:"name" form:"name" validate:"required"`
+	Count  int     `json:"count" form:"count" validate:"max=10"`
+	Amount float64 `json:"amount" form:"amount"`
+	Public bool    `json:"public" form:"public"`
+	Note   *string `json:"note" form:"note" validate:"required,max=5"`
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		params      map[string]string
+		want        bindTestRequest
+		wantErr     []apierr.FieldError
+	}{
+		{
+			name:   "query string on GET",
+			method: http.MethodGet,
+			target: "/?name=a&count=2&amount=1.5&public=true",
+			want:   bindTestRequest{Name: "a", Count: 2, Amount: 1.5, Public: true},
+		},
+		{
+			name:   "query string on POST",
+			method: http.MethodPost,
+			target: "/?name=a&count=3",
+			want:   bindTestRequest{Name: "a", Count: 3},
+		},
+		{
+			name:        "form body over query string",
+			method:      http.MethodPost,
+			target:      "/?name=a&count=3",
+			contentType: echo.MIMEApplicationForm,
+			body:        "name=b",
+			want:        bindTestRequest{Name: "b", Count: 3},
+		},
+		{
+			name:        "JSON body",
+			method:      http.MethodPost,
+			target:      "/",
+			contentType: echo.MIMEApplicationJSON,
+			body:        `{"name":"a","count":4,"public":true}`,
+			want:        bindTestRequest{Name: "a", Count: 4, Public: true},
+		},
+		{
+			name:        "path parameters over body",
+			method:      http.MethodPost,
+			target:      "/",
+			contentType: echo.MIMEApplicationJSON,
+			body:        `{"name":"a","count":4}`,
+			params:      map[string]string{"count": "5"},
+			want:        bindTestRequest{Name: "a", Count: 5},
+		},
+		{
+			name:   "empty values are left alone",
+			method: http.MethodGet,
+			target: "/?name=a&count=&public=",
+			want:   bindTestRequest{Name: "a"},
+		},
+		{
+			name:    "bad number",
+			method:  http.MethodGet,
+			target:  "/?name=a&count=two",
+			wantErr: []apierr.FieldError{apierr.Field("count", "invalid_number")},
+		},
+		{
+			name:    "bad boolean",
+			method:  http.MethodGet,
+			target:  "/?name=a&public=maybe",
+			wantErr: []apierr.FieldError{apierr.Field("public", "invalid_boolean")},
+		},
+		{
+			name:    "bad path parameter",
+			method:  http.MethodPost,
+			target:  "/?name=a",
+			params:  map[string]string{"count": "x"},
+			wantErr: []apierr.FieldError{apierr.Field("count", "invalid_number")},
+		},
+		{
+			name:    "validation",
+			method:  http.MethodPost,
+			target:  "/?count=11",
+			wantErr: []apierr.FieldError{apierr.Field("name", "required"), apierr.Field("count", "out_of_range")},
+		},
+		{
+			name:   "pointer that was sent",
+			method: http.MethodGet,
+			target: "/?name=a&note=hi",
+			want:   bindTestRequest{Name: "a", Note: stringPointer("hi")},
+		},
+		{
+			name:        "pointer that was sent empty",
+			method:      http.MethodPost,
+			target:      "/",
+			contentType: echo.MIMEApplicationJSON,
+			body:        `{"name":"a","note":""}`,
+			wantErr:     []apierr.FieldError{apierr.Field("note", "required")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			if test.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, test.contentType)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			if test.params != nil {
+				c.Set(pathParamsKey, test.params)
+			}
+
+			request := bindTestRequest{}
+			err := bind(c, &request)
+
+			if test.wantErr != nil {
+				apiErr, ok := err.(*apierr.Error)
+				if !ok {
+					t.Fatalf("bind returned %v, want field errors %v", err, test.wantErr)
+				}
+				if !reflect.DeepEqual(apiErr.Fields, test.wantErr) {
+					t.Errorf("bind returned field errors %v, want %v", apiErr.Fields, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("bind returned %v", err)
+			}
+			if !reflect.DeepEqual(request, test.want) {
+				t.Errorf("bind filled in %+v, want %+v", request, test.want)
+			}
+		})
+	}
+}
+
+func TestBindUnsupportedMediaType(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("name: a"))
+	req.Header.Set(echo.HeaderContentType, "text/yaml")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	err := bind(c, &bindTestRequest{})
+	if apiErr, ok := err.(*apierr.Error); !ok || apiErr.Code != "unsupported_media_type" {
+		t.Errorf("bind returned %v, want unsupported_media_type", err)
+	}
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
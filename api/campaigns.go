@@ -0,0 +1,310 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+)
+
+const (
+	defaultLeaderboardSize = 10
+)
+
+// campaignSelectSQL selects everything in a Campaign. The amount raised only counts donations that haven't been voided.
+const campaignSelectSQL = "SELECT c.id, c.schoolId, c.title, c.description, c.start, c.end, c.goal, (SELECT COALESCE(SUM(d.amount), 0) FROM donations d WHERE d.campaignId = c.id AND d.voided IS NULL) FROM campaigns c"
+
+type Campaign struct {
+	ID          int     `json:"id"`
+	SchoolID    int     `json:"school_id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Start       string  `json:"start"`
+	End         string  `json:"end"`
+	Goal        float64 `json:"goal"`
+	Raised      float64 `json:"raised"`
+	Percent     float64 `json:"percent"`
+}
+
+type CampaignResponse struct {
+	Status   string   `json:"status"`
+	Campaign Campaign `json:"campaign"`
+}
+
+type CampaignsResponse struct {
+	Status    string     `json:"status"`
+	Campaigns []Campaign `json:"campaigns"`
+}
+
+type LeaderboardEntry struct {
+	Rank        int     `json:"rank"`
+	SchoolID    int     `json:"school_id"`
+	DisplayName string  `json:"display_name"`
+	Name        string  `json:"name"`
+	Raised      float64 `json:"raised"`
+}
+
+type LeaderboardResponse struct {
+	Status  string             `json:"status"`
+	Start   string             `json:"start"`
+	End     string             `json:"end"`
+	Schools []LeaderboardEntry `json:"schools"`
+}
+
+type campaignScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCampaign(row campaignScanner) (Campaign, error) {
+	campaign := Campaign{}
+
+	err := row.Scan(&campaign.ID, &campaign.SchoolID, &campaign.Title, &campaign.Description, &campaign.Start, &campaign.End, &campaign.Goal, &campaign.Raised)
+	if err != nil {
+		return campaign, err
+	}
+
+	if campaign.Goal > 0 {
+		campaign.Percent = campaign.Raised / campaign.Goal * 100
+	}
+
+	return campaign, nil
+}
+
+func getCampaign(campaignId int) (Campaign, error) {
+	return scanCampaign(db.QueryRow(campaignSelectSQL+" WHERE c.id = ?", campaignId))
+}
+
+// parseDate parses a YYYY-MM-DD date, falling back to the given default when the value is empty.
+func parseDate(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+type leaderboardRequest struct {
+	Start string `json:"start" form:"start" validate:"date"`
+	End   string `json:"end" form:"end" validate:"date"`
+	Limit int    `json:"limit" form:"limit" validate:"min=1,max=100"`
+}
+
+type newCampaignRequest struct {
+	Title       string  `json:"title" form:"title" validate:"required,max=255"`
+	Description string  `json:"description" form:"description"`
+	Start       string  `json:"start" form:"start" validate:"required,date"`
+	End         string  `json:"end" form:"end" validate:"required,date"`
+	Goal        float64 `json:"goal" form:"goal" validate:"required,min=0.01,max=99999999.99"`
+}
+
+func ConfigureCampaigns(e *router) {
+	e.GET("/:schoolId/getCampaigns", func(c echo.Context) error {
+		schoolId, err := strconv.Atoi(c.Param("schoolId"))
+		if err != nil {
+			return apierr.BadRequest("invalid_params")
+		}
+
+		session := authentication.GetSession(c)
+
+		allowed, err := canViewSchool(schoolId, session.UserID)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("invalid_school")
+		}
+		if err != nil {
+			return apierr.Internal("checking school visibility", err)
+		}
+		if !allowed {
+			return apierr.Forbidden("school_unverified")
+		}
+
+		rows, err := db.Query(campaignSelectSQL+" WHERE c.schoolId = ? ORDER BY c.start DESC, c.id DESC", schoolId)
+		if err != nil {
+			return apierr.Internal("getting campaigns", err)
+		}
+
+		defer rows.Close()
+
+		campaigns := []Campaign{}
+
+		for rows.Next() {
+			campaign, err := scanCampaign(rows)
+			if err != nil {
+				return apierr.Internal("scanning campaign", err)
+			}
+
+			campaigns = append(campaigns, campaign)
+		}
+
+		return c.JSON(http.StatusOK, CampaignsResponse{"ok", campaigns})
+	})
+
+	e.GET("/campaigns/get/:id", func(c echo.Context) error {
+		campaignId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return apierr.BadRequest("invalid_params")
+		}
+
+		campaign, err := getCampaign(campaignId)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("campaign_not_found")
+		}
+		if err != nil {
+			return apierr.Internal("getting campaign", err)
+		}
+
+		session := authentication.GetSession(c)
+
+		allowed, err := canViewSchool(campaign.SchoolID, session.UserID)
+		if err != nil {
+			return apierr.Internal("checking school visibility", err)
+		}
+		if !allowed {
+			return apierr.Forbidden("school_unverified")
+		}
+
+		return c.JSON(http.StatusOK, CampaignResponse{"ok", campaign})
+	})
+
+	e.GET("/campaigns/leaderboard", func(c echo.Context) error {
+		request := leaderboardRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		// by default, the leaderboard covers the past year
+		start, _ := parseDate(request.Start, now.AddDate(-1, 0, 0))
+		end, _ := parseDate(request.End, now)
+		if end.Before(start) {
+			return apierr.Invalid(apierr.Field("end", "before_start"))
+		}
+
+		limit := request.Limit
+		if limit == 0 {
+			limit = defaultLeaderboardSize
+		}
+
+		rows, err := db.Query("SELECT s.id, s.displayname, s.name, SUM(d.amount) raised FROM donations d INNER JOIN schools s ON d.schoolId = s.id WHERE s.isVerified = 1 AND d.voided IS NULL AND d.donated BETWEEN ? AND ? GROUP BY s.id, s.displayname, s.name ORDER BY raised DESC, s.name LIMIT ?", start.Format("2006-01-02"), end.Format("2006-01-02"), limit)
+		if err != nil {
+			return apierr.Internal("getting leaderboard", err)
+		}
+
+		defer rows.Close()
+
+		schools := []LeaderboardEntry{}
+
+		for rows.Next() {
+			entry := LeaderboardEntry{Rank: len(schools) + 1}
+
+			err := rows.Scan(&entry.SchoolID, &entry.DisplayName, &entry.Name, &entry.Raised)
+			if err != nil {
+				return apierr.Internal("scanning leaderboard", err)
+			}
+
+			schools = append(schools, entry)
+		}
+
+		return c.JSON(http.StatusOK, LeaderboardResponse{"ok", start.Format("2006-01-02"), end.Format("2006-01-02"), schools})
+	})
+
+	e.POST("/campaigns/new", func(c echo.Context) error {
+		request := newCampaignRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		start, _ := time.Parse("2006-01-02", request.Start)
+		end, _ := time.Parse("2006-01-02", request.End)
+		if end.Before(start) {
+			return apierr.Invalid(apierr.Field("end", "before_start"))
+		}
+
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageFinances)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		result, err := db.Exec("INSERT INTO campaigns (schoolId, title, description, start, end, goal, createdBy, created) VALUES (?, ?, ?, ?, ?, ?, ?, NOW())", schoolId, request.Title, request.Description, request.Start, request.End, request.Goal, session.UserID)
+		if err != nil {
+			return apierr.Internal("adding campaign", err)
+		}
+
+		campaignId, err := result.LastInsertId()
+		if err != nil {
+			return apierr.Internal("getting id of new campaign", err)
+		}
+
+		campaign, err := getCampaign(int(campaignId))
+		if err != nil {
+			return apierr.Internal("getting new campaign", err)
+		}
+
+		return c.JSON(http.StatusOK, CampaignResponse{"ok", campaign})
+	})
+
+	e.POST("/campaigns/delete", func(c echo.Context) error {
+		request := idRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		campaignId := request.ID
+
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageFinances)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		var campaignSchoolId int
+
+		err = db.QueryRow("SELECT schoolId FROM campaigns WHERE id = ?", campaignId).Scan(&campaignSchoolId)
+		if err == sql.ErrNoRows || (err == nil && campaignSchoolId != schoolId) {
+			return apierr.NotFound("campaign_not_found")
+		}
+		if err != nil {
+			return apierr.Internal("getting campaign to delete", err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return apierr.Internal("starting campaign deletion", err)
+		}
+
+		defer tx.Rollback()
+
+		// the donations themselves stay in the ledger, they just stop counting towards a campaign
+		_, err = tx.Exec("UPDATE donations SET campaignId = NULL WHERE campaignId = ?", campaignId)
+		if err != nil {
+			return apierr.Internal("unlinking campaign donations", err)
+		}
+
+		_, err = tx.Exec("DELETE FROM campaigns WHERE id = ?", campaignId)
+		if err != nil {
+			return apierr.Internal("deleting campaign", err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return apierr.Internal("committing campaign deletion", err)
+		}
+
+		return statusOk(c)
+	})
+}
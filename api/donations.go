@@ -0,0 +1,260 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+)
+
+// donationsRaisedSQL sums a school's donations that haven't been voided. It expects the school to be aliased as s.
+const donationsRaisedSQL = "(SELECT COALESCE(SUM(d.amount), 0) FROM donations d WHERE d.schoolId = s.id AND d.voided IS NULL)"
+
+type Donation struct {
+	ID         int     `json:"id"`
+	CampaignID *int    `json:"campaign_id"`
+	Amount     float64 `json:"amount"`
+	Donor      string  `json:"donor"`
+	Anonymous  bool    `json:"anonymous"`
+	Date       string  `json:"date"`
+	Method     string  `json:"method"`
+	Note       string  `json:"note"`
+	RecordedBy User    `json:"recorded_by"`
+	Recorded   string  `json:"recorded"`
+	Voided     bool    `json:"voided"`
+	VoidedBy   *User   `json:"voided_by"`
+	VoidReason string  `json:"void_reason"`
+}
+
+type DonationsResponse struct {
+	Status    string     `json:"status"`
+	Donations []Donation `json:"donations"`
+}
+
+type DonationProgress struct {
+	Raised       float64 `json:"raised"`
+	Goal         float64 `json:"goal"`
+	Percent      float64 `json:"percent"`
+	Donations    int     `json:"donations"`
+	LastDonation string  `json:"last_donation"`
+}
+
+type DonationProgressResponse struct {
+	Status   string           `json:"status"`
+	Progress DonationProgress `json:"progress"`
+}
+
+// getDonationProgress summarizes a school's fundraising, leaving out anything that would identify donors.
+func getDonationProgress(schoolId int) (DonationProgress, error) {
+	progress := DonationProgress{}
+	lastDonation := sql.NullString{}
+
+	err := db.QueryRow("SELECT s.donationGoal, "+donationsRaisedSQL+", (SELECT COUNT(*) FROM donations d WHERE d.schoolId = s.id AND d.voided IS NULL), (SELECT MAX(d.donated) FROM donations d WHERE d.schoolId = s.id AND d.voided IS NULL) FROM schools s WHERE s.id = ?", schoolId).Scan(&progress.Goal, &progress.Raised, &progress.Donations, &lastDonation)
+	if err != nil {
+		return progress, err
+	}
+
+	progress.LastDonation = lastDonation.String
+
+	if progress.Goal > 0 {
+		progress.Percent = progress.Raised / progress.Goal * 100
+	}
+
+	return progress, nil
+}
+
+type recordDonationRequest struct {
+	Amount     float64 `json:"amount" form:"amount" validate:"required,min=0.01,max=99999999.99"`
+	Method     string  `json:"method" form:"method" validate:"required,oneof=cash check card online other"`
+	Date       string  `json:"date" form:"date" validate:"date"`
+	Donor      string  `json:"donor" form:"donor" validate:"max=255"`
+	Anonymous  bool    `json:"anonymous" form:"anonymous"`
+	Note       string  `json:"note" form:"note"`
+	CampaignID int     `json:"campaignId" form:"campaignId"`
+}
+
+type voidDonationRequest struct {
+	ID     int    `json:"id" form:"id" validate:"required"`
+	Reason string `json:"reason" form:"reason" validate:"required"`
+}
+
+func ConfigureDonations(e *router) {
+	e.GET("/:schoolId/getDonationProgress", func(c echo.Context) error {
+		schoolId, err := strconv.Atoi(c.Param("schoolId"))
+		if err != nil {
+			return apierr.BadRequest("invalid_params")
+		}
+
+		session := authentication.GetSession(c)
+
+		allowed, err := canViewSchool(schoolId, session.UserID)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("invalid_school")
+		}
+		if err != nil {
+			return apierr.Internal("checking school visibility", err)
+		}
+		if !allowed {
+			return apierr.Forbidden("school_unverified")
+		}
+
+		progress, err := getDonationProgress(schoolId)
+		if err != nil {
+			return apierr.Internal("getting donation progress", err)
+		}
+
+		return c.JSON(http.StatusOK, DonationProgressResponse{"ok", progress})
+	})
+
+	e.GET("/schools/getDonations", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageFinances)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		rows, err := db.Query("SELECT d.id, d.campaignId, d.amount, d.donorName, d.donated, d.method, d.note, d.recorded, r.id, r.fname, r.lname, d.voided, v.id, v.fname, v.lname, d.voidReason FROM donations d INNER JOIN users r ON d.recordedBy = r.id LEFT OUTER JOIN users v ON d.voidedBy = v.id WHERE d.schoolId = ? ORDER BY d.donated DESC, d.id DESC", schoolId)
+		if err != nil {
+			return apierr.Internal("getting donations", err)
+		}
+
+		defer rows.Close()
+
+		donations := []Donation{}
+
+		for rows.Next() {
+			donation := Donation{RecordedBy: User{GradeLevel: -1}}
+			var recorderFName, recorderLName string
+			var donor, voided, voiderFName, voiderLName, voidReason sql.NullString
+			var campaignId, voiderId sql.NullInt64
+
+			err := rows.Scan(&donation.ID, &campaignId, &donation.Amount, &donor, &donation.Date, &donation.Method, &donation.Note, &donation.Recorded, &donation.RecordedBy.Id, &recorderFName, &recorderLName, &voided, &voiderId, &voiderFName, &voiderLName, &voidReason)
+			if err != nil {
+				return apierr.Internal("scanning donation", err)
+			}
+
+			if campaignId.Valid {
+				id := int(campaignId.Int64)
+				donation.CampaignID = &id
+			}
+
+			donation.Donor = donor.String
+			donation.Anonymous = !donor.Valid
+			donation.RecordedBy.Name = recorderFName + " " + recorderLName
+			donation.Voided = voided.Valid
+			donation.VoidReason = voidReason.String
+
+			if voiderId.Valid {
+				donation.VoidedBy = &User{Id: int(voiderId.Int64), Name: voiderFName.String + " " + voiderLName.String, GradeLevel: -1}
+			}
+
+			donations = append(donations, donation)
+		}
+
+		return c.JSON(http.StatusOK, DonationsResponse{"ok", donations})
+	})
+
+	e.POST("/schools/recordDonation", func(c echo.Context) error {
+		request := recordDonationRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		donated, err := parseDate(request.Date, time.Now())
+		if err != nil || donated.After(time.Now()) {
+			return apierr.Invalid(apierr.Field("date", "invalid_date"))
+		}
+
+		// donations without a donor name, or where the donor asked not to be named, are anonymous
+		donor := sql.NullString{}
+		if name := strings.TrimSpace(request.Donor); name != "" && !request.Anonymous {
+			donor = sql.NullString{String: name, Valid: true}
+		}
+
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageFinances)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		campaignId := sql.NullInt64{}
+		if request.CampaignID != 0 {
+			id := request.CampaignID
+			var campaignSchoolId int
+
+			err = db.QueryRow("SELECT schoolId FROM campaigns WHERE id = ?", id).Scan(&campaignSchoolId)
+			if err == sql.ErrNoRows || (err == nil && campaignSchoolId != schoolId) {
+				return apierr.NotFound("campaign_not_found")
+			}
+			if err != nil {
+				return apierr.Internal("getting campaign of donation", err)
+			}
+
+			campaignId = sql.NullInt64{Int64: int64(id), Valid: true}
+		}
+
+		_, err = db.Exec("INSERT INTO donations (schoolId, campaignId, amount, donorName, donated, method, note, recordedBy, recorded) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())", schoolId, campaignId, request.Amount, donor, donated.Format("2006-01-02"), request.Method, request.Note, session.UserID)
+		if err != nil {
+			return apierr.Internal("recording donation", err)
+		}
+
+		return statusOk(c)
+	})
+
+	e.POST("/schools/voidDonation", func(c echo.Context) error {
+		request := voidDonationRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		id := request.ID
+
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageFinances)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		var donationSchoolId int
+		voided := sql.NullString{}
+
+		err = db.QueryRow("SELECT schoolId, voided FROM donations WHERE id = ?", id).Scan(&donationSchoolId, &voided)
+		if err == sql.ErrNoRows || (err == nil && donationSchoolId != schoolId) {
+			return apierr.NotFound("donation_not_found")
+		}
+		if err != nil {
+			return apierr.Internal("getting donation to void", err)
+		}
+
+		if voided.Valid {
+			return apierr.Conflict("donation_already_voided")
+		}
+
+		// entries are voided rather than deleted so the ledger keeps a record of every correction
+		_, err = db.Exec("UPDATE donations SET voided = NOW(), voidedBy = ?, voidReason = ? WHERE id = ?", session.UserID, request.Reason, id)
+		if err != nil {
+			return apierr.Internal("voiding donation", err)
+		}
+
+		return statusOk(c)
+	})
+}
@@ -1,22 +1,25 @@
 package api
 
 import (
-	"fmt"
+	"database/sql"
 	"github.com/btubbs/datetime"
 	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
 	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
-	"github.com/whiskeybrav/studentclubportal-server/errlog"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
 	"net/http"
 	"strconv"
 )
 
 type Event struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Attendance  string `json:"attendance"`
-	Start       string `json:"start"`
-	End         string `json:"end"`
-	Description string `json:"description"`
+	ID          int          `json:"id"`
+	Title       string       `json:"title"`
+	Attendance  string       `json:"attendance"`
+	Start       string       `json:"start"`
+	End         string       `json:"end"`
+	Description string       `json:"description"`
+	Attachments []Attachment `json:"attachments"`
 }
 
 type EventsResponse struct {
@@ -24,17 +27,37 @@ type EventsResponse struct {
 	Events []Event `json:"events"`
 }
 
-func ConfigureEvents(e *echo.Echo) {
+func getEvent(eventId int) (Event, error) {
+	event := Event{}
+
+	err := db.QueryRow("SELECT id, attendance, title, start, end, description FROM events WHERE id = ?", eventId).Scan(&event.ID, &event.Attendance, &event.Title, &event.Start, &event.End, &event.Description)
+	if err != nil {
+		return event, err
+	}
+
+	event.Attachments, err = getAttachments("eventAttachments", "eventId", event.ID)
+	return event, err
+}
+
+type newEventRequest struct {
+	Title       string `json:"title" form:"title" validate:"required,max=255"`
+	Description string `json:"description" form:"description" validate:"required"`
+	Attendance  string `json:"attendance" form:"attendance" validate:"required"`
+	Start       string `json:"start" form:"start" validate:"required,datetime"`
+	End         string `json:"end" form:"end" validate:"required,datetime"`
+	Attachments string `json:"attachments" form:"attachments"`
+}
+
+func ConfigureEvents(e *router) {
 	e.GET("/:schoolId/getEvents", func(c echo.Context) error {
 		schoolId, err := strconv.Atoi(c.Param("schoolId"))
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "invalid_params"})
+			return apierr.BadRequest("invalid_params")
 		}
 
 		rows, err := db.Query("SELECT id, attendance, title, start, end, description FROM events WHERE end > NOW() AND schoolId = ?", schoolId)
 		if err != nil {
-			errlog.LogError("getting events", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting events", err)
 		}
 
 		defer rows.Close()
@@ -45,26 +68,31 @@ func ConfigureEvents(e *echo.Echo) {
 			event := Event{}
 			err := rows.Scan(&event.ID, &event.Attendance, &event.Title, &event.Start, &event.End, &event.Description)
 			if err != nil {
-				errlog.LogError("scanning event", err)
-				return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+				return apierr.Internal("scanning event", err)
 			}
 
 			events = append(events, event)
 		}
 
+		for i := range events {
+			events[i].Attachments, err = getAttachments("eventAttachments", "eventId", events[i].ID)
+			if err != nil {
+				return apierr.Internal("getting event attachments", err)
+			}
+		}
+
 		return c.JSON(http.StatusOK, EventsResponse{"ok", events})
 	})
 
 	e.GET("/:schoolId/getAllEvents", func(c echo.Context) error {
 		schoolId, err := strconv.Atoi(c.Param("schoolId"))
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "invalid_params"})
+			return apierr.BadRequest("invalid_params")
 		}
 
 		rows, err := db.Query("SELECT id, attendance, title, start, end, description FROM events WHERE schoolId = ?", schoolId)
 		if err != nil {
-			errlog.LogError("getting events", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting events", err)
 		}
 
 		var events []Event
@@ -73,86 +101,150 @@ func ConfigureEvents(e *echo.Echo) {
 			event := Event{}
 			err := rows.Scan(&event.ID, &event.Attendance, &event.Title, &event.Start, &event.End, &event.Description)
 			if err != nil {
-				errlog.LogError("scanning event", err)
-				return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+				return apierr.Internal("scanning event", err)
 			}
 
 			events = append(events, event)
 		}
 
+		for i := range events {
+			events[i].Attachments, err = getAttachments("eventAttachments", "eventId", events[i].ID)
+			if err != nil {
+				return apierr.Internal("getting event attachments", err)
+			}
+		}
+
 		return c.JSON(http.StatusOK, EventsResponse{"ok", events})
 	})
 
 	e.POST("/events/new", func(c echo.Context) error {
-		if c.FormValue("title") == "" || c.FormValue("description") == "" || c.FormValue("attendance") == "" || c.FormValue("start") == "" || c.FormValue("end") == "" {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+		request := newEventRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
 		}
 
 		// the date of a format string according to go's docs should be Mon Jan 2 15:04:05 -0700 MST 2006, and MySQL defines that their dates are in the
 		// YYYY-MM-DD hh:mm:ss format, therefore the following format string is used
 
-		startTimeObj, err := datetime.ParseUTC(c.FormValue("start"))
-		endTimeObj, err := datetime.ParseUTC(c.FormValue("end"))
+		// both were checked to be ISO8601 by bind, so MySQL will be able to handle them
+		startTimeObj, _ := datetime.ParseUTC(request.Start)
+		endTimeObj, _ := datetime.ParseUTC(request.End)
+
+		attachmentIds, err := parseAttachmentIds(request.Attachments)
 		if err != nil {
-			// the date is not ISO8601 formatted, so MySQL won't be able to handle it. We therefore need to return invalid_params.
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+			return apierr.BadRequest("invalid_params")
 		}
 
 		session := authentication.GetSession(c)
 
-		var schoolId int
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageEvents)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
 
-		err = db.QueryRow("SELECT id from schools WHERE clubheadId = ? OR facultyadviserId = ?", session.UserID, session.UserID).Scan(&schoolId)
+		ok, err := attachmentsBelongToSchool(attachmentIds, schoolId)
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "unauthorized"})
+			return apierr.Internal("checking event attachments", err)
+		}
+		if !ok {
+			return apierr.BadRequest("invalid_attachment")
 		}
 
 		startTime := fixTime(startTimeObj)
 		endTime := fixTime(endTimeObj)
 
-		_, err = db.Exec("INSERT INTO events (attendance, title, start, end, description, schoolId) VALUES (?, ?, ?, ?, ?, ?)", c.FormValue("attendance"), c.FormValue("title"), startTime, endTime, c.FormValue("description"), schoolId)
+		tx, err := db.Begin()
 		if err != nil {
-			errlog.LogError("adding post", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("starting to add event", err)
 		}
 
+		defer tx.Rollback()
+
+		result, err := tx.Exec("INSERT INTO events (attendance, title, start, end, description, schoolId) VALUES (?, ?, ?, ?, ?, ?)", request.Attendance, request.Title, startTime, endTime, request.Description, schoolId)
+		if err != nil {
+			return apierr.Internal("adding event", err)
+		}
+
+		eventId, err := result.LastInsertId()
+		if err != nil {
+			return apierr.Internal("getting id of new event", err)
+		}
+
+		err = addAttachments(tx, "eventAttachments", "eventId", eventId, attachmentIds)
+		if err != nil {
+			return apierr.Internal("adding event attachments", err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return apierr.Internal("committing new event", err)
+		}
+
+		event, err := getEvent(int(eventId))
+		if err != nil {
+			logging.FromContext(c).Error("getting new event", err)
+		} else {
+			publish(schoolId, StreamEventCreated, event)
+		}
+
+		notifySchool(schoolId, session.UserID, notifications.Notification{
+			Type:  notifications.TypeNewEvent,
+			Title: "New event: " + request.Title,
+			Body:  excerpt(request.Description),
+		})
+
 		return c.JSON(http.StatusOK, StatusResponse{"ok"})
 	})
 
 	e.POST("/events/delete", func(c echo.Context) error {
-		fmt.Println(c.FormValue("id"))
-		postId, err := strconv.Atoi(c.FormValue("id"))
+		request := idRequest{}
+		err := bind(c, &request)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+			return err
 		}
 
-		session := authentication.GetSession(c)
+		postId := request.ID
 
-		var schoolId int
+		session := authentication.GetSession(c)
 
-		err = db.QueryRow("SELECT id from schools WHERE clubheadId = ? OR facultyadviserId = ?", session.UserID, session.UserID).Scan(&schoolId)
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageEvents)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "unauthorized"})
+			return apierr.Internal("checking permissions", err)
 		}
 
 		var eventSchoolId int
 
 		err = db.QueryRow("SELECT schoolId from events WHERE id = ?", postId).Scan(&eventSchoolId)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("event_not_found")
+		}
 		if err != nil {
-			errlog.LogError("getting id of event to delete", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting id of event to delete", err)
 		}
 
 		if schoolId != eventSchoolId {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "unauthorized"})
+			return forbidden(c)
+		}
+
+		_, err = db.Exec("DELETE FROM eventAttachments WHERE eventId = ?", postId)
+		if err != nil {
+			return apierr.Internal("deleting event attachments", err)
 		}
 
 		_, err = db.Exec("DELETE FROM events WHERE id = ?", postId)
 		if err != nil {
-			errlog.LogError("deleting event", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("deleting event", err)
 		}
 
+		publish(schoolId, StreamEventDeleted, DeletedItem{postId})
+
 		return c.JSON(http.StatusOK, StatusResponse{"ok"})
 	})
 }
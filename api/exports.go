@@ -0,0 +1,165 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/export"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+)
+
+// exportRows runs the query and streams every row to the client as a file in the requested format. scan turns the
+// current row into cells.
+func exportRows(c echo.Context, filename string, header []string, query string, args []interface{}, scan func(rows *sql.Rows) ([]string, error)) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+
+	contentType, ok := export.ContentTypes[format]
+	if !ok {
+		return apierr.BadRequest("invalid_params")
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return apierr.Internal("exporting "+filename, err)
+	}
+
+	defer rows.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, contentType)
+	res.Header().Set(echo.HeaderContentDisposition, contentDisposition("attachment", filename+"-"+time.Now().Format("2006-01-02")+"."+format))
+	res.WriteHeader(http.StatusOK)
+
+	// from here on the status has been sent, so errors can only be logged and the download cut short
+	w := export.NewWriter(format, res)
+
+	err = w.WriteRow(header)
+	if err != nil {
+		return nil
+	}
+
+	for rows.Next() {
+		cells, err := scan(rows)
+		if err != nil {
+			logging.FromContext(c).Error("scanning "+filename+" export", err)
+			return nil
+		}
+
+		err = w.WriteRow(cells)
+		if err != nil {
+			return nil
+		}
+	}
+
+	if rows.Err() != nil {
+		logging.FromContext(c).Error("reading "+filename+" export", rows.Err())
+		return nil
+	}
+
+	err = w.Close()
+	if err != nil {
+		logging.FromContext(c).Error("finishing "+filename+" export", err)
+	}
+
+	return nil
+}
+
+func ConfigureExports(e *router) {
+	e.GET("/schools/export/members", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageMembers)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		return exportRows(c, "members", []string{"First name", "Last name", "Email", "Type", "Grade level", "Joined"},
+			"SELECT u.fname, u.lname, u.email, u.type, u.gradeLevel, COALESCE(m.decided, m.requested) FROM memberships m INNER JOIN users u ON m.userId = u.id WHERE m.schoolId = ? AND m.status = ? ORDER BY u.lname, u.fname",
+			[]interface{}{schoolId, MembershipActive},
+			func(rows *sql.Rows) ([]string, error) {
+				var fname, lname, email, joined string
+				var userType int
+				gradeLevel := sql.NullInt64{}
+
+				err := rows.Scan(&fname, &lname, &email, &userType, &gradeLevel, &joined)
+				if err != nil {
+					return nil, err
+				}
+
+				typeName := "Student"
+				if userType == UserTypeTeacher {
+					typeName = "Teacher"
+				}
+
+				grade := ""
+				if gradeLevel.Valid && userType == UserTypeStudent {
+					grade = strconv.FormatInt(gradeLevel.Int64, 10)
+				}
+
+				return []string{fname, lname, email, typeName, grade, joined}, nil
+			})
+	})
+
+	e.GET("/schools/export/posts", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionPost)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		return exportRows(c, "posts", []string{"Date", "Title", "Author", "Text"},
+			"SELECT p.date, p.title, u.fname, u.lname, p.text FROM posts p INNER JOIN users u ON p.authorId = u.id WHERE p.schoolId = ? ORDER BY p.date",
+			[]interface{}{schoolId},
+			func(rows *sql.Rows) ([]string, error) {
+				var date, title, fname, lname, text string
+
+				err := rows.Scan(&date, &title, &fname, &lname, &text)
+				if err != nil {
+					return nil, err
+				}
+
+				return []string{date, title, fname + " " + lname, text}, nil
+			})
+	})
+
+	e.GET("/schools/export/events", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageEvents)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		return exportRows(c, "events", []string{"Title", "Start", "End", "Attendance", "Description"},
+			"SELECT title, start, end, attendance, description FROM events WHERE schoolId = ? ORDER BY start",
+			[]interface{}{schoolId},
+			func(rows *sql.Rows) ([]string, error) {
+				var title, start, end, attendance, description string
+
+				err := rows.Scan(&title, &start, &end, &attendance, &description)
+				if err != nil {
+					return nil, err
+				}
+
+				return []string{title, start, end, attendance, description}, nil
+			})
+	})
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/version"
+)
+
+const defaultHealthTimeout = 2 * time.Second
+
+// draining is set once the server starts shutting down, so load balancers stop sending it new requests.
+var draining int32
+
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+type HealthResponse struct {
+	Status  string                 `json:"status"`
+	Version string                 `json:"version"`
+	Checks  map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// Drain makes /readyz fail from now on.
+func Drain() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// IsHealthCheck reports whether the request is a probe, which shouldn't get a session.
+func IsHealthCheck(c echo.Context) bool {
+	path := c.Request().URL.Path
+	return path == "/healthz" || path == "/readyz"
+}
+
+// runHealthCheck runs a check with a timeout. Why a check failed is only logged, since probes can be reached by anyone.
+func runHealthCheck(name string, check func(ctx context.Context) error) HealthCheck {
+	timeout := defaultHealthTimeout
+	if config.Health.TimeoutSeconds > 0 {
+		timeout = time.Duration(config.Health.TimeoutSeconds * float64(time.Second))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := HealthCheck{
+		Status:    "ok",
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = "error"
+		logging.Log.Error("health check "+name+" failed", err)
+	}
+
+	return result
+}
+
+func checkDatabase(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
+
+// checkSMTP connects to the mail server and waits for its greeting, without sending anything.
+func checkSMTP(ctx context.Context) error {
+	dialer := net.Dialer{}
+	host := config.Mail.SMTPHost
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(config.Mail.SMTPPort)))
+	if err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	return client.Quit()
+}
+
+// checkMigrations compares the schema version this build expects with the newest migration applied to the database.
+func checkMigrations(ctx context.Context) error {
+	applied := 0
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schemaMigrations").Scan(&applied)
+	if err != nil {
+		return err
+	}
+
+	if applied < version.SchemaVersion {
+		return fmt.Errorf("database is at migration %d but this build needs %d", applied, version.SchemaVersion)
+	}
+
+	return nil
+}
+
+func ConfigureHealth(e *router) {
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, HealthResponse{Status: "ok", Version: version.Version})
+	})
+
+	e.GET("/readyz", func(c echo.Context) error {
+		response := HealthResponse{
+			Status:  "ok",
+			Version: version.Version,
+			Checks: map[string]HealthCheck{
+				"database": runHealthCheck("database", checkDatabase),
+			},
+		}
+
+		if config.Health.CheckSMTP {
+			response.Checks["smtp"] = runHealthCheck("smtp", checkSMTP)
+		}
+
+		if config.Health.CheckMigrations {
+			response.Checks["migrations"] = runHealthCheck("migrations", checkMigrations)
+		}
+
+		if isDraining() {
+			response.Checks["draining"] = HealthCheck{Status: "error"}
+		}
+
+		for _, check := range response.Checks {
+			if check.Status != "ok" {
+				response.Status = "error"
+			}
+		}
+
+		if response.Status != "ok" {
+			return c.JSON(http.StatusServiceUnavailable, response)
+		}
+
+		return c.JSON(http.StatusOK, response)
+	})
+}
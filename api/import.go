@@ -0,0 +1,300 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/NoteToScreen/maily-go/maily"
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/mail"
+	"github.com/whiskeybrav/studentclubportal-server/util"
+)
+
+const maxImportRows = 1000
+
+var errTooManyRows = errors.New("too many rows to import")
+
+const (
+	ImportRowNew      = "new"
+	ImportRowExisting = "existing"
+	ImportRowInvalid  = "invalid"
+
+	// ImportRowFailed rows were new, but their account couldn't be created. Nothing was saved for them, so importing
+	// the roster again retries them.
+	ImportRowFailed = "failed"
+)
+
+type ImportRow struct {
+	Line       int    `json:"line"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	GradeLevel int    `json:"grade_level"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	Status    string      `json:"status"`
+	Confirmed bool        `json:"confirmed"`
+	New       int         `json:"new"`
+	Existing  int         `json:"existing"`
+	Invalid   int         `json:"invalid"`
+	Failed    int         `json:"failed"`
+	Rows      []ImportRow `json:"rows"`
+}
+
+// importRequest goes with the roster, which is uploaded as file.
+type importRequest struct {
+	Confirm bool `json:"confirm" form:"confirm"`
+}
+
+// readImport checks every row of an uploaded roster. A header row is skipped if there is one. Rows that are valid are
+// new until markExisting checks them against existing accounts.
+func readImport(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows []ImportRow
+	seen := map[string]bool{}
+	line := 0
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+
+		if line == 1 && len(record) >= 2 && strings.EqualFold(strings.TrimSpace(record[1]), "email") {
+			continue
+		}
+
+		if len(rows) >= maxImportRows {
+			return nil, errTooManyRows
+		}
+
+		row := ImportRow{Line: line, Result: ImportRowInvalid}
+
+		if len(record) != 3 {
+			row.Error = "wrong_column_count"
+			rows = append(rows, row)
+			continue
+		}
+
+		row.Name = strings.TrimSpace(record[0])
+		row.Email = strings.ToLower(strings.TrimSpace(record[1]))
+		gradeLevel, err := strconv.Atoi(strings.TrimSpace(record[2]))
+
+		switch {
+		case row.Name == "":
+			row.Error = "missing_name"
+		case !util.EmailIsValid(row.Email):
+			row.Error = "invalid_email"
+		case err != nil || gradeLevel < 1 || gradeLevel > 12:
+			row.Error = "invalid_grade_level"
+		case seen[row.Email]:
+			row.Error = "duplicate_email"
+		default:
+			row.GradeLevel = gradeLevel
+			row.Result = ImportRowNew
+		}
+
+		if row.Result == ImportRowNew {
+			seen[row.Email] = true
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// markExisting changes new rows whose email already has an account to existing.
+func markExisting(rows []ImportRow) error {
+	for i, row := range rows {
+		if row.Result != ImportRowNew {
+			continue
+		}
+
+		id := 0
+		err := db.QueryRow("SELECT id FROM users WHERE email = ?", row.Email).Scan(&id)
+		if err == nil {
+			rows[i].Result = ImportRowExisting
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitName splits a full name from a spreadsheet into a first name and everything else.
+func splitName(name string) (string, string) {
+	fields := strings.Fields(name)
+	if len(fields) == 1 {
+		return fields[0], ""
+	}
+	return fields[0], strings.Join(fields[1:], " ")
+}
+
+// unusablePassword is stored for imported accounts until their owners set a password. It isn't a bcrypt hash, so no
+// password matches it.
+const unusablePassword = "!"
+
+// createImportedUser makes a placeholder account that can only be used once its owner sets a password with the key
+// that gets emailed to them. The account, its membership and its key are added together, or not at all.
+func createImportedUser(row ImportRow, schoolId int, adviserId int) (string, error) {
+	key, err := util.GenerateRandomString(26)
+	if err != nil {
+		return "", err
+	}
+
+	fname, lname := splitName(row.Name)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO users (fname, showsLastname, lname, email, password, schoolId, type, userLevel, gradeLevel, howDidYouHear, registration) VALUES (?, 0, ?, ?, ?, ?, ?, 0, ?, ?, NOW())",
+		fname, lname, row.Email, unusablePassword, schoolId, UserTypeStudent, row.GradeLevel, "Imported by adviser")
+	if err != nil {
+		return "", err
+	}
+
+	userId, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("INSERT INTO memberships (userId, schoolId, status, requested, decided, decidedBy) VALUES (?, ?, ?, NOW(), NOW(), ?)", userId, schoolId, MembershipActive, adviserId)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec("INSERT INTO passwordResets (userId, `key`, expiry) VALUES (?, ?, ADDDATE(NOW(), INTERVAL 7 DAY))", userId, key)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	publishMemberJoined(int(userId), schoolId)
+
+	return key, nil
+}
+
+func ConfigureImport(e *router) {
+	e.POST("/schools/importMembers", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		var schoolId int
+		var schoolName string
+
+		err := db.QueryRow("SELECT id, name from schools WHERE facultyadviserId = ?", session.UserID).Scan(&schoolId, &schoolName)
+		if err == sql.ErrNoRows || session.UserID == -1 {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		request := importRequest{}
+		err = bind(c, &request)
+		if err != nil {
+			return err
+		}
+		confirm := request.Confirm
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return apierr.BadRequest("invalid_params")
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			return apierr.Internal("opening uploaded roster", err)
+		}
+
+		defer file.Close()
+
+		rows, err := readImport(file)
+		if err == errTooManyRows {
+			return apierr.New(http.StatusRequestEntityTooLarge, "too_many_rows")
+		}
+		if err != nil {
+			return apierr.BadRequest("invalid_csv")
+		}
+
+		err = markExisting(rows)
+		if err != nil {
+			return apierr.Internal("checking for existing accounts", err)
+		}
+
+		adviserFName := ""
+		adviserLName := ""
+		if confirm {
+			err = db.QueryRow("SELECT fname, lname FROM users WHERE id = ?", session.UserID).Scan(&adviserFName, &adviserLName)
+			if err != nil {
+				return apierr.Internal("getting adviser name", err)
+			}
+		}
+
+		response := ImportResponse{Status: "ok", Confirmed: confirm, Rows: rows}
+
+		for i, row := range rows {
+			if row.Result != ImportRowNew || !confirm {
+				continue
+			}
+
+			key, err := createImportedUser(row, schoolId, session.UserID)
+			if err != nil {
+				logging.FromContext(c).Error("creating imported user", err)
+				response.Rows[i].Result = ImportRowFailed
+				response.Rows[i].Error = "internal_server_error"
+				continue
+			}
+
+			fname, lname := splitName(row.Name)
+
+			// a full roster takes too long to email during the request
+			mail.Queue(strings.TrimSpace(fname+" "+lname), row.Email, "memberInvite", maily.TemplateData{
+				"fname":       fname,
+				"schoolName":  schoolName,
+				"adviserName": adviserFName + " " + adviserLName,
+				"key":         key,
+			})
+		}
+
+		for _, row := range response.Rows {
+			switch row.Result {
+			case ImportRowNew:
+				response.New++
+			case ImportRowExisting:
+				response.Existing++
+			case ImportRowInvalid:
+				response.Invalid++
+			case ImportRowFailed:
+				response.Failed++
+			}
+		}
+
+		return c.JSON(http.StatusOK, response)
+	})
+}
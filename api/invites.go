@@ -0,0 +1,483 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/util"
+)
+
+// inviteAlphabet leaves out characters that are easy to mix up when a code is written on a whiteboard.
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const inviteCodeLength = 8
+
+// These are the roles an invite can hand out on top of membership. Officer invites hand out the title and permissions
+// stored with them.
+const (
+	InviteRoleMember   = ""
+	InviteRoleClubHead = "clubHead"
+	InviteRoleOfficer  = "officer"
+)
+
+var errInviteInvalid = errors.New("invite is invalid, expired or used up")
+
+type Invite struct {
+	ID       int    `json:"id"`
+	SchoolID int    `json:"school_id"`
+	Code     string `json:"code"`
+	Link     string `json:"link"`
+	Created  string `json:"created"`
+	Expiry   string `json:"expiry"`
+	MaxUses  int    `json:"max_uses"`
+	Uses     int    `json:"uses"`
+	Role     string `json:"role"`
+	Revoked  bool   `json:"revoked"`
+
+	// Title and Permissions are the role officer invites hand out
+	Title       string       `json:"title,omitempty"`
+	Permissions *Permissions `json:"permissions,omitempty"`
+
+	createdBy int
+}
+
+type InviteResponse struct {
+	Status string `json:"status"`
+	Invite Invite `json:"invite"`
+}
+
+type InvitesResponse struct {
+	Status  string   `json:"status"`
+	Invites []Invite `json:"invites"`
+}
+
+func generateInviteCode() (string, error) {
+	b, err := util.GenerateRandomBytes(inviteCodeLength)
+	if err != nil {
+		return "", err
+	}
+
+	code := make([]byte, inviteCodeLength)
+	for i := range b {
+		code[i] = inviteAlphabet[int(b[i])%len(inviteAlphabet)]
+	}
+	return string(code), nil
+}
+
+func inviteLink(code string) string {
+	return config.Server.FrontendURL + "/#/join/" + code
+}
+
+// normalizeInviteCode lets people type codes in lowercase or with spaces.
+func normalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.Replace(code, " ", "", -1))
+}
+
+const inviteColumns = "id, schoolId, code, createdBy, created, expiry, maxUses, uses, role, revoked, title, canPost, canManageEvents, canManageMembers, canManageFinances, canManageProfile"
+
+func scanInvite(scanner interface{ Scan(...interface{}) error }) (Invite, error) {
+	invite := Invite{}
+	expiry := sql.NullString{}
+	maxUses := sql.NullInt64{}
+	revoked := 0
+	var canPost, canManageEvents, canManageMembers, canManageFinances, canManageProfile int
+
+	err := scanner.Scan(&invite.ID, &invite.SchoolID, &invite.Code, &invite.createdBy, &invite.Created, &expiry, &maxUses, &invite.Uses, &invite.Role, &revoked, &invite.Title, &canPost, &canManageEvents, &canManageMembers, &canManageFinances, &canManageProfile)
+	if err != nil {
+		return invite, err
+	}
+
+	invite.Link = inviteLink(invite.Code)
+	invite.Expiry = expiry.String
+	invite.MaxUses = int(maxUses.Int64)
+	invite.Revoked = revoked == 1
+
+	if invite.Role == InviteRoleOfficer {
+		invite.Permissions = &Permissions{
+			Post:           canPost == 1,
+			ManageEvents:   canManageEvents == 1,
+			ManageMembers:  canManageMembers == 1,
+			ManageFinances: canManageFinances == 1,
+			ManageProfile:  canManageProfile == 1,
+		}
+	}
+
+	return invite, nil
+}
+
+// findInvite returns the invite with the given code if it can still be used.
+func findInvite(code string) (Invite, error) {
+	invite, err := scanInvite(db.QueryRow("SELECT "+inviteColumns+" FROM invites WHERE code = ? AND revoked = 0 AND (expiry IS NULL OR expiry > NOW()) AND (maxUses IS NULL OR uses < maxUses)", normalizeInviteCode(code)))
+	if err == sql.ErrNoRows {
+		return invite, errInviteInvalid
+	}
+	return invite, err
+}
+
+// joinWithInvite uses up one of the invite's uses and makes the user an active member of its school, with whatever
+// role the invite hands out. If the user is moving from another school, leaveSchoolId is that school, and they're
+// removed from it. It's all one transaction, so a failure doesn't use up the invite.
+func joinWithInvite(userId int, invite Invite, leaveSchoolId int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE invites SET uses = uses + 1 WHERE id = ? AND revoked = 0 AND (expiry IS NULL OR expiry > NOW()) AND (maxUses IS NULL OR uses < maxUses)", invite.ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// someone else took the last use since we looked it up
+		return errInviteInvalid
+	}
+
+	_, err = tx.Exec("INSERT INTO memberships (userId, schoolId, status, requested, decided, decidedBy, inviteId) VALUES (?, ?, ?, NOW(), NOW(), ?, ?) ON DUPLICATE KEY UPDATE status = VALUES(status), requested = NOW(), decided = NOW(), decidedBy = VALUES(decidedBy), inviteId = VALUES(inviteId)",
+		userId, invite.SchoolID, MembershipActive, invite.createdBy, invite.ID)
+	if err != nil {
+		return err
+	}
+
+	if leaveSchoolId != 0 && leaveSchoolId != invite.SchoolID {
+		_, err = tx.Exec("UPDATE memberships SET status = ? WHERE userId = ? AND schoolId = ?", MembershipRemoved, userId, leaveSchoolId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE users SET schoolId = ? WHERE id = ?", invite.SchoolID, userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	var handover *clubHeadHandover
+	switch invite.Role {
+	case InviteRoleClubHead:
+		handover, err = setClubHead(tx, invite.SchoolID, userId, invite.createdBy)
+	case InviteRoleOfficer:
+		err = assignRole(tx, invite.SchoolID, userId, invite.Title, *invite.Permissions)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	publishMemberJoined(userId, invite.SchoolID)
+	handover.announce()
+
+	return nil
+}
+
+// registrationSchool works out which school a new user is signing up for, from either an invite code or a schoolId.
+func registrationSchool(schoolId int, inviteCode string) (int, *Invite, error) {
+	if inviteCode == "" {
+		return schoolId, nil, nil
+	}
+
+	invite, err := findInvite(inviteCode)
+	if err != nil {
+		return 0, nil, err
+	}
+	return invite.SchoolID, &invite, nil
+}
+
+// joinAfterRegistration adds a newly registered user to their school. Users with an invite are let in straight away,
+// everyone else has to wait for a leader to approve them.
+func joinAfterRegistration(userId int, schoolId int, invite *Invite) error {
+	if invite != nil {
+		err := joinWithInvite(userId, *invite, 0)
+		if err != errInviteInvalid {
+			return err
+		}
+		// the invite ran out while they were registering, so fall back to asking
+	}
+	return requestMembership(userId, schoolId, MembershipPending)
+}
+
+// createInviteRequest leaves expiresInDays and maxUses at zero for invites that don't expire or run out. The title and
+// permissions are only for officer invites.
+type createInviteRequest struct {
+	ExpiresInDays  int    `json:"expiresInDays" form:"expiresInDays" validate:"min=1,max=365"`
+	MaxUses        int    `json:"maxUses" form:"maxUses" validate:"min=1"`
+	Role           string `json:"role" form:"role" validate:"oneof=clubHead officer"`
+	Title          string `json:"title" form:"title" validate:"max=64"`
+	Post           bool   `json:"post" form:"post"`
+	ManageEvents   bool   `json:"manageEvents" form:"manageEvents"`
+	ManageMembers  bool   `json:"manageMembers" form:"manageMembers"`
+	ManageFinances bool   `json:"manageFinances" form:"manageFinances"`
+	ManageProfile  bool   `json:"manageProfile" form:"manageProfile"`
+}
+
+type joinRequest struct {
+	Code string `json:"code" form:"code" validate:"required"`
+}
+
+func ConfigureInvites(e *router) {
+	e.POST("/schools/createInvite", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageMembers)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		request := createInviteRequest{}
+		err = bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		expiresInDays := sql.NullInt64{Int64: int64(request.ExpiresInDays), Valid: request.ExpiresInDays != 0}
+		maxUses := sql.NullInt64{Int64: int64(request.MaxUses), Valid: request.MaxUses != 0}
+
+		role := request.Role
+		title := ""
+		p := Permissions{}
+
+		switch role {
+		case InviteRoleMember:
+		case InviteRoleClubHead, InviteRoleOfficer:
+			// only advisers hand out roles, as with /schools/assignRole, so officers can't invite their way around it
+			adviser, err := isAdviser(session.UserID, schoolId)
+			if err != nil {
+				return apierr.Internal("checking permissions", err)
+			}
+			if !adviser {
+				return forbidden(c)
+			}
+
+			// a role is for one person, so the invite can only be used once
+			if maxUses.Valid && maxUses.Int64 != 1 {
+				return apierr.Invalid(apierr.Field("maxUses", "out_of_range"))
+			}
+			maxUses = sql.NullInt64{Int64: 1, Valid: true}
+
+			if role == InviteRoleOfficer {
+				title = strings.TrimSpace(request.Title)
+				if !validOfficerTitle(title) {
+					return apierr.Invalid(apierr.Field("title", "invalid_choice"))
+				}
+
+				p = Permissions{
+					Post:           request.Post,
+					ManageEvents:   request.ManageEvents,
+					ManageMembers:  request.ManageMembers,
+					ManageFinances: request.ManageFinances,
+					ManageProfile:  request.ManageProfile,
+				}
+			}
+		}
+
+		code, err := generateInviteCode()
+		if err != nil {
+			return apierr.Internal("generating invite code", err)
+		}
+
+		// DATE_ADD gives NULL, meaning no expiry, if expiresInDays is NULL
+		result, err := db.Exec("INSERT INTO invites (schoolId, code, createdBy, created, expiry, maxUses, uses, role, revoked, title, canPost, canManageEvents, canManageMembers, canManageFinances, canManageProfile) VALUES (?, ?, ?, NOW(), DATE_ADD(NOW(), INTERVAL ? DAY), ?, 0, ?, 0, ?, ?, ?, ?, ?, ?)",
+			schoolId, code, session.UserID, expiresInDays, maxUses, role, title, p.Post, p.ManageEvents, p.ManageMembers, p.ManageFinances, p.ManageProfile)
+		if err != nil {
+			return apierr.Internal("adding invite", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return apierr.Internal("getting id of new invite", err)
+		}
+
+		invite, err := scanInvite(db.QueryRow("SELECT "+inviteColumns+" FROM invites WHERE id = ?", id))
+		if err != nil {
+			return apierr.Internal("getting new invite", err)
+		}
+
+		return c.JSON(http.StatusOK, InviteResponse{"ok", invite})
+	})
+
+	e.GET("/schools/getInvites", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageMembers)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		adviser, err := isAdviser(session.UserID, schoolId)
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		// role invites are only for the adviser to see, since anyone with the code can use it to take the role
+		query := "SELECT " + inviteColumns + " FROM invites WHERE schoolId = ?"
+		if !adviser {
+			query += " AND role = ''"
+		}
+
+		rows, err := db.Query(query+" ORDER BY created DESC", schoolId)
+		if err != nil {
+			return apierr.Internal("getting invites", err)
+		}
+
+		defer rows.Close()
+
+		invites := []Invite{}
+
+		for rows.Next() {
+			invite, err := scanInvite(rows)
+			if err != nil {
+				return apierr.Internal("scanning invite", err)
+			}
+			invites = append(invites, invite)
+		}
+
+		return c.JSON(http.StatusOK, InvitesResponse{"ok", invites})
+	})
+
+	e.POST("/schools/revokeInvite", func(c echo.Context) error {
+		request := idRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		inviteId := request.ID
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageMembers)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		var role string
+		err = db.QueryRow("SELECT role FROM invites WHERE id = ? AND schoolId = ?", inviteId, schoolId).Scan(&role)
+		if err == sql.ErrNoRows {
+			return statusOk(c)
+		}
+		if err != nil {
+			return apierr.Internal("getting invite", err)
+		}
+
+		if role != InviteRoleMember {
+			adviser, err := isAdviser(session.UserID, schoolId)
+			if err != nil {
+				return apierr.Internal("checking permissions", err)
+			}
+			if !adviser {
+				return forbidden(c)
+			}
+		}
+
+		_, err = db.Exec("UPDATE invites SET revoked = 1 WHERE id = ? AND schoolId = ?", inviteId, schoolId)
+		if err != nil {
+			return apierr.Internal("revoking invite", err)
+		}
+
+		return statusOk(c)
+	})
+
+	e.GET("/schools/getInvite/:code", func(c echo.Context) error {
+		// lets the join page show which school the code is for before the user commits
+		invite, err := findInvite(c.Param("code"))
+		if err == errInviteInvalid {
+			return apierr.NotFound("invalid_invite")
+		}
+		if err != nil {
+			return apierr.Internal("getting invite", err)
+		}
+
+		var displayName string
+		err = db.QueryRow("SELECT displayname FROM schools WHERE id = ?", invite.SchoolID).Scan(&displayName)
+		if err != nil {
+			return apierr.Internal("getting school of invite", err)
+		}
+
+		return c.JSON(http.StatusOK, LoginResponse{"ok", displayName})
+	})
+
+	e.POST("/schools/join", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+		if session.UserID == -1 {
+			return apierr.Unauthorized("logged_out")
+		}
+
+		request := joinRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		invite, err := findInvite(request.Code)
+		if err == errInviteInvalid {
+			return apierr.NotFound("invalid_invite")
+		}
+		if err != nil {
+			return apierr.Internal("getting invite", err)
+		}
+
+		var currentSchoolId, userType int
+		err = db.QueryRow("SELECT schoolId, type FROM users WHERE id = ?", session.UserID).Scan(&currentSchoolId, &userType)
+		if err != nil {
+			return apierr.Internal("getting user joining school", err)
+		}
+
+		if invite.Role == InviteRoleClubHead && userType != UserTypeStudent {
+			return apierr.BadRequest("invite_for_students")
+		}
+
+		status, err := getMembershipStatus(session.UserID, invite.SchoolID)
+		if err != nil {
+			return apierr.Internal("getting membership status", err)
+		}
+		if currentSchoolId == invite.SchoolID && status == MembershipActive {
+			return apierr.Conflict("already_member")
+		}
+
+		if currentSchoolId != invite.SchoolID {
+			_, err = schoolWithPermission(session.UserID)
+			if err == nil {
+				// a school can't be left without its leader
+				return apierr.Conflict("leads_another_school")
+			}
+		}
+
+		err = joinWithInvite(session.UserID, invite, currentSchoolId)
+		if err == errInviteInvalid {
+			return apierr.NotFound("invalid_invite")
+		}
+		if err != nil {
+			return apierr.Internal("joining school with invite", err)
+		}
+
+		var displayName string
+		err = db.QueryRow("SELECT displayname FROM schools WHERE id = ?", invite.SchoolID).Scan(&displayName)
+		if err != nil {
+			return apierr.Internal("getting school of invite", err)
+		}
+
+		return c.JSON(http.StatusOK, LoginResponse{"ok", displayName})
+	})
+}
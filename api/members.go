@@ -0,0 +1,197 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
+)
+
+const (
+	MembershipPending = "pending"
+	MembershipActive  = "active"
+	MembershipRemoved = "removed"
+)
+
+type MemberRequest struct {
+	User      User   `json:"user"`
+	Email     string `json:"email"`
+	Type      int    `json:"type"`
+	Requested string `json:"requested"`
+}
+
+type MemberRequestsResponse struct {
+	Status   string          `json:"status"`
+	Requests []MemberRequest `json:"requests"`
+}
+
+// requestMembership records that a user wants to join a school, or puts a removed member back in the queue.
+func requestMembership(userId int, schoolId int, status string) error {
+	_, err := db.Exec("INSERT INTO memberships (userId, schoolId, status, requested) VALUES (?, ?, ?, NOW()) ON DUPLICATE KEY UPDATE status = VALUES(status), requested = NOW(), decided = NULL, decidedBy = NULL", userId, schoolId, status)
+	return err
+}
+
+// getMembershipStatus returns the status of the user at the school, or an empty string if they never asked to join.
+func getMembershipStatus(userId int, schoolId int) (string, error) {
+	status := ""
+	err := db.QueryRow("SELECT status FROM memberships WHERE userId = ? AND schoolId = ?", userId, schoolId).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return status, err
+}
+
+// checkMember makes sure the user is an active member of the school, and of the given type.
+func checkMember(userId int, schoolId int, userType int) (bool, error) {
+	var actualType, userSchoolId int
+	err := db.QueryRow("SELECT type, schoolId FROM users WHERE id = ?", userId).Scan(&actualType, &userSchoolId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if actualType != userType || userSchoolId != schoolId {
+		return false, nil
+	}
+
+	status, err := getMembershipStatus(userId, schoolId)
+	return status == MembershipActive, err
+}
+
+// decideMembership is shared by the approve, reject and remove endpoints. from is the status the membership has to be
+// in for the change to apply.
+func decideMembership(c echo.Context, from []string, to string) error {
+	request := idRequest{}
+	err := bind(c, &request)
+	if err != nil {
+		return err
+	}
+
+	memberId := request.ID
+	session := authentication.GetSession(c)
+
+	schoolId, err := schoolWithPermission(session.UserID, PermissionManageMembers)
+	if err == sql.ErrNoRows {
+		return forbidden(c)
+	}
+	if err != nil {
+		return apierr.Internal("checking permissions", err)
+	}
+
+	var clubHeadId, facultyAdviserId int
+
+	err = db.QueryRow("SELECT clubheadId, facultyadviserId from schools WHERE id = ?", schoolId).Scan(&clubHeadId, &facultyAdviserId)
+	if err != nil {
+		return apierr.Internal("getting school leaders", err)
+	}
+
+	if memberId == facultyAdviserId || memberId == clubHeadId {
+		// leaders have to be replaced before they can be removed
+		return apierr.BadRequest("cannot_remove_leader")
+	}
+
+	status, err := getMembershipStatus(memberId, schoolId)
+	if err != nil {
+		return apierr.Internal("getting membership status", err)
+	}
+
+	allowed := false
+	for _, s := range from {
+		if status == s {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return apierr.NotFound("membership_not_found")
+	}
+
+	_, err = db.Exec("UPDATE memberships SET status = ?, decided = NOW(), decidedBy = ? WHERE userId = ? AND schoolId = ?", to, session.UserID, memberId, schoolId)
+	if err != nil {
+		return apierr.Internal("updating membership", err)
+	}
+
+	if to == MembershipActive {
+		publishMemberJoined(memberId, schoolId)
+
+		var schoolName, displayName string
+		err = db.QueryRow("SELECT name, displayname FROM schools WHERE id = ?", schoolId).Scan(&schoolName, &displayName)
+		if err != nil {
+			logging.FromContext(c).Error("getting school for membership notification", err)
+		} else {
+			notifyUsers([]int{memberId}, notifications.Notification{
+				Type:  notifications.TypeMembershipApproved,
+				Title: "You're in!",
+				Body:  "Your request to join " + schoolName + " was approved.",
+				Link:  "/" + displayName,
+			})
+		}
+	} else if status == MembershipActive {
+		err = removeRole(schoolId, memberId)
+		if err != nil {
+			logging.FromContext(c).Error("removing role of removed member", err)
+		}
+
+		publish(schoolId, StreamMemberRemoved, DeletedItem{memberId})
+	}
+
+	return statusOk(c)
+}
+
+func ConfigureMembers(e *router) {
+	e.GET("/schools/getMemberRequests", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageMembers)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		rows, err := db.Query("SELECT u.id, u.fname, u.lname, u.email, u.type, u.gradeLevel, m.requested FROM memberships m INNER JOIN users u ON m.userId = u.id WHERE m.schoolId = ? AND m.status = ? ORDER BY m.requested", schoolId, MembershipPending)
+		if err != nil {
+			return apierr.Internal("getting member requests", err)
+		}
+
+		defer rows.Close()
+
+		requests := []MemberRequest{}
+
+		for rows.Next() {
+			request := MemberRequest{}
+			fname := ""
+			lname := ""
+
+			err := rows.Scan(&request.User.Id, &fname, &lname, &request.Email, &request.Type, &request.User.GradeLevel, &request.Requested)
+			if err != nil {
+				return apierr.Internal("scanning member request", err)
+			}
+
+			// leaders need the full name to know who they're letting in
+			request.User.Name = fname + " " + lname
+
+			requests = append(requests, request)
+		}
+
+		return c.JSON(http.StatusOK, MemberRequestsResponse{"ok", requests})
+	})
+
+	e.POST("/schools/approveMember", func(c echo.Context) error {
+		return decideMembership(c, []string{MembershipPending}, MembershipActive)
+	})
+
+	e.POST("/schools/rejectMember", func(c echo.Context) error {
+		return decideMembership(c, []string{MembershipPending}, MembershipRemoved)
+	})
+
+	e.POST("/schools/removeMember", func(c echo.Context) error {
+		return decideMembership(c, []string{MembershipActive}, MembershipRemoved)
+	})
+}
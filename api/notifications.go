@@ -0,0 +1,323 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"html/template"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/mail"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
+)
+
+const notificationsPageSize = 50
+
+type NotificationsResponse struct {
+	Status        string                       `json:"status"`
+	Notifications []notifications.Notification `json:"notifications"`
+}
+
+type UnreadCountResponse struct {
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
+
+type PreferencesResponse struct {
+	Status      string                    `json:"status"`
+	Preferences notifications.Preferences `json:"preferences"`
+}
+
+type notificationsRequest struct {
+	UnreadOnly bool `json:"unreadOnly" form:"unreadOnly"`
+}
+
+// markReadRequest marks the notification with the id as read, or every notification if all is true.
+type markReadRequest struct {
+	ID  int  `json:"id" form:"id"`
+	All bool `json:"all" form:"all"`
+}
+
+// preferencesRequest changes the preferences that are sent and leaves the rest as they are.
+type preferencesRequest struct {
+	Digest         *bool `json:"digest" form:"digest"`
+	EventReminders *bool `json:"eventReminders" form:"eventReminders"`
+	CommentReplies *bool `json:"commentReplies" form:"commentReplies"`
+	AdminNotices   *bool `json:"adminNotices" form:"adminNotices"`
+}
+
+// unsubscribeRequest carries the signed token from an unsubscribe link.
+type unsubscribeRequest struct {
+	Token string `json:"token" form:"token"`
+}
+
+// legacyUnsubscribeRequest carries the key from a digest email sent before unsubscribe links were signed.
+type legacyUnsubscribeRequest struct {
+	Key string `json:"key" form:"key"`
+}
+
+// setPreference changes current to the value that was sent, if one was.
+func setPreference(current *bool, sent *bool) {
+	if sent != nil {
+		*current = *sent
+	}
+}
+
+// excerpt shortens text to fit in a notification.
+func excerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= 200 {
+		return text
+	}
+	return string(runes[:200]) + "…"
+}
+
+// notifySchool tells every member of a school about something, except whoever did it. Failing to notify shouldn't
+// fail the request that caused it, so errors are only logged.
+func notifySchool(schoolId int, exceptUserId int, n notifications.Notification) {
+	var displayName string
+	err := db.QueryRow("SELECT displayname FROM schools WHERE id = ?", schoolId).Scan(&displayName)
+	if err != nil {
+		logging.Log.Error("getting school for notification", err)
+		return
+	}
+
+	if n.Link == "" {
+		n.Link = "/" + displayName
+	}
+
+	err = notifications.NotifySchool(schoolId, exceptUserId, n)
+	if err != nil {
+		logging.Log.Error("notifying school", err)
+	}
+}
+
+// notifyUsers is like notifySchool, but for specific users.
+func notifyUsers(userIds []int, n notifications.Notification) {
+	err := notifications.Notify(userIds, n)
+	if err != nil {
+		logging.Log.Error("notifying users", err)
+	}
+}
+
+func ConfigureNotifications(e *router) {
+	e.GET("/notifications/get", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+		if session.UserID == -1 {
+			return apierr.Unauthorized("logged_out")
+		}
+
+		request := notificationsRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		list, err := notifications.List(session.UserID, request.UnreadOnly, notificationsPageSize)
+		if err != nil {
+			return apierr.Internal("getting notifications", err)
+		}
+
+		return c.JSON(http.StatusOK, NotificationsResponse{"ok", list})
+	})
+
+	e.GET("/notifications/unreadCount", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+		if session.UserID == -1 {
+			return apierr.Unauthorized("logged_out")
+		}
+
+		count, err := notifications.UnreadCount(session.UserID)
+		if err != nil {
+			return apierr.Internal("counting unread notifications", err)
+		}
+
+		return c.JSON(http.StatusOK, UnreadCountResponse{"ok", count})
+	})
+
+	e.POST("/notifications/markRead", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+		if session.UserID == -1 {
+			return apierr.Unauthorized("logged_out")
+		}
+
+		request := markReadRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		if request.All {
+			err := notifications.MarkAllRead(session.UserID)
+			if err != nil {
+				return apierr.Internal("marking all notifications read", err)
+			}
+			return statusOk(c)
+		}
+
+		if request.ID == 0 {
+			return apierr.Invalid(apierr.Field("id", "required"))
+		}
+
+		err = notifications.MarkRead(session.UserID, request.ID)
+		if err != nil {
+			return apierr.Internal("marking notification read", err)
+		}
+
+		return statusOk(c)
+	})
+
+	e.POST("/notifications/updatePreferences", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+		if session.UserID == -1 {
+			return apierr.Unauthorized("logged_out")
+		}
+
+		request := preferencesRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		preferences, err := notifications.GetPreferences(session.UserID)
+		if err != nil {
+			return apierr.Internal("getting notification preferences", err)
+		}
+
+		setPreference(&preferences.Digest, request.Digest)
+		setPreference(&preferences.EventReminders, request.EventReminders)
+		setPreference(&preferences.CommentReplies, request.CommentReplies)
+		setPreference(&preferences.AdminNotices, request.AdminNotices)
+
+		err = notifications.SetPreferences(session.UserID, preferences)
+		if err != nil {
+			return apierr.Internal("setting notification preferences", err)
+		}
+
+		return c.JSON(http.StatusOK, PreferencesResponse{"ok", preferences})
+	})
+
+	// links in emails open a page asking to confirm, since mail scanners and link previews follow links without the
+	// user clicking them. Only POST unsubscribes, which is also what mail clients use for one-click unsubscribing
+	// (RFC 8058). Neither needs the user to be logged in.
+	e.GET("/notifications/unsubscribe", func(c echo.Context) error {
+		request := unsubscribeRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "This unsubscribe link is invalid.")
+		}
+
+		_, category, err := mail.ParseUnsubscribeToken(request.Token)
+		if err != nil || !notifications.ValidCategory(category) {
+			return c.String(http.StatusBadRequest, "This unsubscribe link is invalid.")
+		}
+
+		return confirmUnsubscribe(c, "Stop getting "+categoryNames[category]+" emails from Whiskey Bravo Student Clubs?", "token", request.Token)
+	})
+
+	e.POST("/notifications/unsubscribe", func(c echo.Context) error {
+		// one-click unsubscribes send the token in the query string, with a body only saying that it's one-click
+		request := unsubscribeRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "This unsubscribe link is invalid.")
+		}
+
+		userId, category, err := mail.ParseUnsubscribeToken(request.Token)
+		if err != nil || !notifications.ValidCategory(category) {
+			return c.String(http.StatusBadRequest, "This unsubscribe link is invalid.")
+		}
+
+		err = notifications.Unsubscribe(userId, category)
+		if err != nil {
+			logging.FromContext(c).Error("unsubscribing from notifications", err)
+			return c.String(http.StatusInternalServerError, "Something went wrong, please try again later.")
+		}
+
+		return c.String(http.StatusOK, "You have been unsubscribed. You can change which emails you get from your account settings.")
+	})
+
+	// digest emails sent before signed links existed point here
+	legacyUnsubscribeUser := func(c echo.Context) (int, string, bool) {
+		request := legacyUnsubscribeRequest{}
+		err := bind(c, &request)
+		if err != nil || request.Key == "" {
+			return 0, "", false
+		}
+
+		var userId int
+		err = db.QueryRow("SELECT id FROM users WHERE unsubscribeKey = ?", request.Key).Scan(&userId)
+		if err != nil && err != sql.ErrNoRows {
+			logging.FromContext(c).Error("finding user to unsubscribe from digest", err)
+		}
+		return userId, request.Key, err == nil
+	}
+
+	e.GET("/digest/unsubscribe", func(c echo.Context) error {
+		_, key, ok := legacyUnsubscribeUser(c)
+		if !ok {
+			return c.String(http.StatusBadRequest, "This unsubscribe link is invalid.")
+		}
+
+		return confirmUnsubscribe(c, "Stop getting the Whiskey Bravo Student Clubs digest?", "key", key)
+	})
+
+	e.POST("/digest/unsubscribe", func(c echo.Context) error {
+		userId, _, ok := legacyUnsubscribeUser(c)
+		if !ok {
+			return c.String(http.StatusBadRequest, "This unsubscribe link is invalid.")
+		}
+
+		err := notifications.Unsubscribe(userId, notifications.CategoryDigest)
+		if err != nil {
+			logging.FromContext(c).Error("unsubscribing from digest", err)
+			return c.String(http.StatusInternalServerError, "Something went wrong, please try again later.")
+		}
+
+		return c.String(http.StatusOK, "You have been unsubscribed from the Whiskey Bravo Student Clubs digest.")
+	})
+}
+
+// categoryNames describe each category of email on the unsubscribe page.
+var categoryNames = map[string]string{
+	notifications.CategoryDigest:         "digest",
+	notifications.CategoryEventReminders: "event reminder",
+	notifications.CategoryCommentReplies: "comment reply",
+	notifications.CategoryAdminNotices:   "admin notice",
+}
+
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Unsubscribe</title>
+</head>
+<body>
+<p>{{.Question}}</p>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="{{.Field}}" value="{{.Value}}">
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`))
+
+// confirmUnsubscribe sends a page with a button that POSTs the unsubscribe link's field back to the same path.
+func confirmUnsubscribe(c echo.Context, question string, field string, value string) error {
+	var page bytes.Buffer
+	err := unsubscribePage.Execute(&page, map[string]string{
+		"Question": question,
+		"Action":   c.Request().URL.Path,
+		"Field":    field,
+		"Value":    value,
+	})
+	if err != nil {
+		return apierr.Internal("rendering unsubscribe page", err)
+	}
+
+	return c.HTMLBlob(http.StatusOK, page.Bytes())
+}
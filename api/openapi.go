@@ -0,0 +1,445 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/version"
+)
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Tags        []string                   `json:"tags"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Content map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+}
+
+// openAPIField is a value sent to a route, either in its query string or its body.
+type openAPIField struct {
+	name     string
+	required bool
+	schema   *openAPISchema
+}
+
+// openAPI is the document served at /v1/openapi.json, built from the routes table.
+var openAPI openAPIDocument
+
+// openAPIPath turns an echo path like /v1/schools/:schoolId/posts into /v1/schools/{schoolId}/posts.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func buildOpenAPIDocument() openAPIDocument {
+	document := openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "Student Club Portal API",
+			Description: "Routes outside /v1 that are marked as deprecated are the paths routes had before the API was versioned. They still work, and respond with a Link header pointing to the route's current path.\n\nEvery response has an X-CSRF-Token header, which has to be sent back in the X-CSRF-Token header of requests that change something. A request without a session cookie can't have the right token, so make a GET request, like GET /v1/auth/me, first.",
+			Version:     version.Version,
+		},
+		Paths: map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{
+			Schemas: map[string]*openAPISchema{
+				"FieldError": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"field": {Type: "string"},
+						"error": {Type: "string", Enum: apierr.FieldCodes},
+					},
+					Required: []string{"field", "error"},
+				},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		if route.path != "" {
+			document.addOperation(route.method, route.path, route, false)
+		}
+		if route.legacy != "" {
+			method, path := route.legacyRoute()
+			document.addOperation(method, path, route, true)
+		}
+	}
+
+	return document
+}
+
+func (d *openAPIDocument) addOperation(method, path string, route route, legacy bool) {
+	operation := &openAPIOperation{
+		Summary:    route.summary,
+		Tags:       []string{route.tag},
+		Deprecated: legacy,
+		Responses:  map[string]openAPIResponse{},
+	}
+
+	// path parameters are documented as such, and not again as part of the body
+	inPath := map[string]bool{}
+	for _, name := range pathParamNames(path) {
+		schema := &openAPISchema{Type: "string"}
+		if strings.HasSuffix(strings.ToLower(name), "id") {
+			schema.Type = "integer"
+		}
+
+		operation.Parameters = append(operation.Parameters, openAPIParameter{name, "path", true, schema})
+
+		if legacy {
+			inPath[name] = true
+		} else {
+			inPath[route.formName(name)] = true
+		}
+	}
+
+	if route.needsCSRFToken(method) {
+		operation.Parameters = append(operation.Parameters, openAPIParameter{authentication.HeaderCSRFToken, "header", true, &openAPISchema{Type: "string"}})
+	}
+
+	var fields []openAPIField
+	if route.request != nil {
+		fields = requestFields(reflect.TypeOf(route.request))
+	}
+	for _, name := range route.fields {
+		schema := &openAPISchema{Type: "string"}
+		if name == "file" {
+			schema.Format = "binary"
+		}
+		fields = append(fields, openAPIField{name, false, schema})
+	}
+
+	body := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	for _, field := range fields {
+		if inPath[field.name] {
+			continue
+		}
+
+		if method == http.MethodGet {
+			operation.Parameters = append(operation.Parameters, openAPIParameter{field.name, "query", field.required, field.schema})
+			continue
+		}
+
+		body.Properties[field.name] = field.schema
+		if field.required {
+			body.Required = append(body.Required, field.name)
+		}
+	}
+
+	if len(body.Properties) > 0 {
+		contentTypes := []string{"application/json", "application/x-www-form-urlencoded", "multipart/form-data"}
+		if body.Properties["file"] != nil {
+			contentTypes = []string{"multipart/form-data"}
+		}
+
+		operation.RequestBody = &openAPIRequestBody{Content: map[string]openAPIMediaType{}}
+		for _, contentType := range contentTypes {
+			operation.RequestBody.Content[contentType] = openAPIMediaType{body}
+		}
+	}
+
+	switch response := route.response.(type) {
+	case nil:
+		operation.Responses["200"] = openAPIResponse{Description: "OK"}
+	case string:
+		operation.Responses["200"] = openAPIResponse{"OK", map[string]openAPIMediaType{response: {contentSchema(response)}}}
+	case []string:
+		content := map[string]openAPIMediaType{}
+		for _, contentType := range response {
+			content[contentType] = openAPIMediaType{contentSchema(contentType)}
+		}
+		operation.Responses["200"] = openAPIResponse{"OK", content}
+	default:
+		schema := d.schemaOf(reflect.TypeOf(response))
+		operation.Responses["200"] = openAPIResponse{"OK", map[string]openAPIMediaType{"application/json": {schema}}}
+	}
+
+	d.addErrors(operation, method, route)
+
+	if d.Paths[openAPIPath(path)] == nil {
+		d.Paths[openAPIPath(path)] = map[string]*openAPIOperation{}
+	}
+	d.Paths[openAPIPath(path)][strings.ToLower(method)] = operation
+}
+
+// contentSchema describes a response that isn't a struct. Anything that isn't text or JSON is binary.
+func contentSchema(contentType string) *openAPISchema {
+	schema := &openAPISchema{Type: "string"}
+	if !strings.HasPrefix(contentType, "text/") && contentType != "application/json" {
+		schema.Format = "binary"
+	}
+	return schema
+}
+
+// addErrors documents the error codes a route can respond with, grouped by their status.
+func (d *openAPIDocument) addErrors(operation *openAPIOperation, method string, route route) {
+	codes := route.errorCodes(method)
+
+	byStatus := map[int][]string{}
+	for _, code := range codes {
+		errorCode, ok := apierr.Codes[code]
+		if !ok {
+			panic("api: error code " + code + " isn't in apierr.Codes")
+		}
+		if !contains(byStatus[errorCode.Status], code) {
+			byStatus[errorCode.Status] = append(byStatus[errorCode.Status], code)
+		}
+	}
+
+	for status, codes := range byStatus {
+		sort.Strings(codes)
+
+		descriptions := make([]string, len(codes))
+		for i, code := range codes {
+			descriptions[i] = "`" + code + "`: " + apierr.Codes[code].Description
+		}
+
+		schema := &openAPISchema{
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"status":     {Type: "string", Enum: []string{"error"}},
+				"error":      {Type: "string", Enum: codes},
+				"request_id": {Type: "string"},
+			},
+			Required: []string{"status", "error"},
+		}
+		if status == http.StatusBadRequest && route.request != nil {
+			schema.Properties["fields"] = &openAPISchema{Type: "array", Items: &openAPISchema{Ref: "#/components/schemas/FieldError"}}
+		}
+
+		operation.Responses[strconv.Itoa(status)] = openAPIResponse{
+			Description: strings.Join(descriptions, "\n\n"),
+			Content:     map[string]openAPIMediaType{"application/json": {schema}},
+		}
+	}
+}
+
+// schemaOf describes how a type is encoded as JSON. Named structs are added to the document's components and
+// referenced from there.
+func (d *openAPIDocument) schemaOf(t reflect.Type) *openAPISchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return d.schemaOf(t.Elem())
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openAPISchema{Type: "string", Format: "byte"}
+		}
+		return &openAPISchema{Type: "array", Items: d.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+	case reflect.Interface:
+		return &openAPISchema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+
+		if _, ok := d.Components.Schemas[t.Name()]; !ok {
+			// add a placeholder first, in case the struct refers to itself
+			d.Components.Schemas[t.Name()] = &openAPISchema{}
+			d.Components.Schemas[t.Name()] = d.structSchema(t)
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	}
+
+	panic("api: can't describe " + t.String() + " in the OpenAPI document")
+}
+
+func (d *openAPIDocument) structSchema(t reflect.Type) *openAPISchema {
+	schema := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			embedded := d.structSchema(field.Type)
+			for name, property := range embedded.Properties {
+				schema.Properties[name] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name, options := field.Name, ""
+		if tag := field.Tag.Get("json"); tag != "" {
+			name, options = tag, ""
+			if i := strings.Index(tag, ","); i != -1 {
+				name, options = tag[:i], tag[i+1:]
+			}
+		}
+		if name == "-" {
+			continue
+		}
+
+		schema.Properties[name] = d.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// requestFields lists the fields of a request struct by their form names, described by their validate rules.
+func requestFields(t reflect.Type) []openAPIField {
+	var fields []openAPIField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := field.Tag.Get("form")
+		if name == "" {
+			name = field.Name
+		}
+
+		// pointers are for fields that may be left out, even if they can't be empty when they're sent
+		fieldType := field.Type
+		optional := fieldType.Kind() == reflect.Ptr
+		if optional {
+			fieldType = fieldType.Elem()
+		}
+
+		schema := &openAPISchema{}
+		switch fieldType.Kind() {
+		case reflect.String:
+			schema.Type = "string"
+		case reflect.Int, reflect.Int64:
+			schema.Type = "integer"
+		case reflect.Float64:
+			schema.Type = "number"
+		case reflect.Bool:
+			schema.Type = "boolean"
+		}
+
+		required := false
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			ruleName, arg := rule, ""
+			if i := strings.Index(rule, "="); i != -1 {
+				ruleName, arg = rule[:i], rule[i+1:]
+			}
+
+			switch ruleName {
+			case "required":
+				required = !optional
+			case "email":
+				schema.Format = "email"
+			case "password":
+				schema.Format = "password"
+			case "url":
+				schema.Format = "uri"
+			case "state":
+				schema.Pattern = "^[A-Za-z]{2}$"
+			case "letters":
+				schema.Pattern = `^\p{L}+$`
+			case "date":
+				schema.Format = "date"
+			case "datetime":
+				schema.Format = "date-time"
+			case "min", "max":
+				limit, _ := strconv.ParseFloat(arg, 64)
+				length := int(limit)
+
+				switch {
+				case schema.Type == "string" && ruleName == "min":
+					schema.MinLength = &length
+				case schema.Type == "string":
+					schema.MaxLength = &length
+				case ruleName == "min":
+					schema.Minimum = &limit
+				default:
+					schema.Maximum = &limit
+				}
+			case "oneof":
+				schema.Enum = strings.Fields(arg)
+			}
+		}
+
+		fields = append(fields, openAPIField{name, required, schema})
+	}
+
+	return fields
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,21 +1,24 @@
 package api
 
 import (
-	"fmt"
+	"database/sql"
 	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
 	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
-	"github.com/whiskeybrav/studentclubportal-server/errlog"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
 	"net/http"
 	"strconv"
 )
 
 type Post struct {
-	ID       int    `json:"id"`
-	Title    string `json:"title"`
-	Date     string `json:"date"`
-	Text     string `json:"text"`
-	SchoolID int    `json:"school_id"`
-	Author   string `json:"author"`
+	ID          int          `json:"id"`
+	Title       string       `json:"title"`
+	Date        string       `json:"date"`
+	Text        string       `json:"text"`
+	SchoolID    int          `json:"school_id"`
+	Author      string       `json:"author"`
+	Attachments []Attachment `json:"attachments"`
 }
 
 type PostsResponse struct {
@@ -23,17 +26,42 @@ type PostsResponse struct {
 	Posts  []Post `json:"posts"`
 }
 
-func ConfigurePosts(e *echo.Echo) {
+func getPost(postId int) (Post, error) {
+	post := Post{}
+	var firstname, lastname string
+	var showsLastname int
+
+	err := db.QueryRow("SELECT p.id, title, date, text, p.schoolId, u.fname, u.lname, u.showsLastname FROM posts p INNER JOIN users u on p.authorId = u.id WHERE p.id = ?", postId).Scan(&post.ID, &post.Title, &post.Date, &post.Text, &post.SchoolID, &firstname, &lastname, &showsLastname)
+	if err != nil {
+		return post, err
+	}
+
+	if showsLastname == 1 {
+		post.Author = firstname + " " + lastname
+	} else {
+		post.Author = firstname
+	}
+
+	post.Attachments, err = getAttachments("postAttachments", "postId", post.ID)
+	return post, err
+}
+
+type newPostRequest struct {
+	Title       string `json:"title" form:"title" validate:"required,max=255"`
+	Text        string `json:"text" form:"text" validate:"required"`
+	Attachments string `json:"attachments" form:"attachments"`
+}
+
+func ConfigurePosts(e *router) {
 	e.GET("/:schoolId/getPosts", func(c echo.Context) error {
 		schoolId, err := strconv.Atoi(c.Param("schoolId"))
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "invalid_params"})
+			return apierr.BadRequest("invalid_params")
 		}
 
 		rows, err := db.Query("SELECT p.id, title, date, text, p.schoolId, u.fname, u.lname, u.showsLastname FROM posts p INNER JOIN users u on p.authorId = u.id WHERE p.schoolId = ? ", schoolId)
 		if err != nil {
-			errlog.LogError("getting posts", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting posts", err)
 		}
 
 		var posts []Post
@@ -44,8 +72,7 @@ func ConfigurePosts(e *echo.Echo) {
 			var showsLastname int
 			err := rows.Scan(&post.ID, &post.Title, &post.Date, &post.Text, &post.SchoolID, &firstname, &lastname, &showsLastname)
 			if err != nil {
-				errlog.LogError("getting posts", err)
-				return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+				return apierr.Internal("getting posts", err)
 			}
 
 			if showsLastname == 1 {
@@ -57,6 +84,13 @@ func ConfigurePosts(e *echo.Echo) {
 			posts = append(posts, post)
 		}
 
+		for i := range posts {
+			posts[i].Attachments, err = getAttachments("postAttachments", "postId", posts[i].ID)
+			if err != nil {
+				return apierr.Internal("getting post attachments", err)
+			}
+		}
+
 		return c.JSON(http.StatusOK, PostsResponse{
 			Status: "ok",
 			Posts:  posts,
@@ -64,62 +98,123 @@ func ConfigurePosts(e *echo.Echo) {
 	})
 
 	e.POST("/posts/new", func(c echo.Context) error {
-		if c.FormValue("title") == "" || c.FormValue("text") == "" {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+		request := newPostRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		attachmentIds, err := parseAttachmentIds(request.Attachments)
+		if err != nil {
+			return apierr.BadRequest("invalid_params")
 		}
 
 		session := authentication.GetSession(c)
 
-		var schoolId int
+		schoolId, err := schoolWithPermission(session.UserID, PermissionPost)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
 
-		err := db.QueryRow("SELECT id from schools WHERE clubheadId = ? OR facultyadviserId = ?", session.UserID, session.UserID).Scan(&schoolId)
+		ok, err := attachmentsBelongToSchool(attachmentIds, schoolId)
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "unauthorized"})
+			return apierr.Internal("checking post attachments", err)
 		}
+		if !ok {
+			return apierr.BadRequest("invalid_attachment")
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return apierr.Internal("starting to add post", err)
+		}
+
+		defer tx.Rollback()
 
-		_, err = db.Exec("INSERT INTO posts (title, schoolId, date, authorId, `text`) VALUES (?, ?, NOW(), ?, ?)", c.FormValue("title"), schoolId, session.UserID, c.FormValue("text"))
+		result, err := tx.Exec("INSERT INTO posts (title, schoolId, date, authorId, `text`) VALUES (?, ?, NOW(), ?, ?)", request.Title, schoolId, session.UserID, request.Text)
 		if err != nil {
-			errlog.LogError("adding post", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("adding post", err)
 		}
 
+		postId, err := result.LastInsertId()
+		if err != nil {
+			return apierr.Internal("getting id of new post", err)
+		}
+
+		err = addAttachments(tx, "postAttachments", "postId", postId, attachmentIds)
+		if err != nil {
+			return apierr.Internal("adding post attachments", err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return apierr.Internal("committing new post", err)
+		}
+
+		post, err := getPost(int(postId))
+		if err != nil {
+			logging.FromContext(c).Error("getting new post", err)
+		} else {
+			publish(schoolId, StreamPostCreated, post)
+		}
+
+		notifySchool(schoolId, session.UserID, notifications.Notification{
+			Type:  notifications.TypeNewPost,
+			Title: "New post: " + request.Title,
+			Body:  excerpt(request.Text),
+		})
+
 		return c.JSON(http.StatusOK, StatusResponse{"ok"})
 	})
 
 	e.POST("/posts/delete", func(c echo.Context) error {
-		fmt.Println(c.FormValue("id"))
-		postId, err := strconv.Atoi(c.FormValue("id"))
+		request := idRequest{}
+		err := bind(c, &request)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+			return err
 		}
 
-		session := authentication.GetSession(c)
+		postId := request.ID
 
-		var schoolId int
+		session := authentication.GetSession(c)
 
-		err = db.QueryRow("SELECT id from schools WHERE clubheadId = ? OR facultyadviserId = ?", session.UserID, session.UserID).Scan(&schoolId)
+		schoolId, err := schoolWithPermission(session.UserID, PermissionPost)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "unauthorized"})
+			return apierr.Internal("checking permissions", err)
 		}
 
 		var postSchoolId int
 
 		err = db.QueryRow("SELECT schoolId from posts WHERE id = ?", postId).Scan(&postSchoolId)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("post_not_found")
+		}
 		if err != nil {
-			errlog.LogError("getting id of post to delete", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting id of post to delete", err)
 		}
 
 		if schoolId != postSchoolId {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "unauthorized"})
+			return forbidden(c)
+		}
+
+		_, err = db.Exec("DELETE FROM postAttachments WHERE postId = ?", postId)
+		if err != nil {
+			return apierr.Internal("deleting post attachments", err)
 		}
 
 		_, err = db.Exec("DELETE FROM posts WHERE id = ?", postId)
 		if err != nil {
-			errlog.LogError("deleting post", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("deleting post", err)
 		}
 
+		publish(schoolId, StreamPostDeleted, DeletedItem{postId})
+
 		return c.JSON(http.StatusOK, StatusResponse{"ok"})
 	})
 }
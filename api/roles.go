@@ -0,0 +1,454 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
+)
+
+// These are the things an officer can be allowed to do. The values are the schoolRoles columns that hold them.
+const (
+	PermissionPost           = "canPost"
+	PermissionManageEvents   = "canManageEvents"
+	PermissionManageMembers  = "canManageMembers"
+	PermissionManageFinances = "canManageFinances"
+	PermissionManageProfile  = "canManageProfile"
+)
+
+const ClubHeadTitle = "Club Head"
+
+type Permissions struct {
+	Post           bool `json:"post"`
+	ManageEvents   bool `json:"manage_events"`
+	ManageMembers  bool `json:"manage_members"`
+	ManageFinances bool `json:"manage_finances"`
+	ManageProfile  bool `json:"manage_profile"`
+}
+
+// clubHeadPermissions is what club heads could do before there were other officers.
+var clubHeadPermissions = Permissions{
+	Post:          true,
+	ManageEvents:  true,
+	ManageMembers: true,
+	ManageProfile: true,
+}
+
+type Officer struct {
+	User        User        `json:"user"`
+	Title       string      `json:"title"`
+	Permissions Permissions `json:"permissions"`
+}
+
+// schoolWithPermission returns the school where the user may do any of the given things. Faculty advisers can do
+// everything at their school, and officers what their role allows. With no permissions given, any officer will do.
+func schoolWithPermission(userId int, permissions ...string) (int, error) {
+	var schoolId int
+
+	if userId == -1 {
+		// schools without a leader store -1, which must never match a logged out user
+		return 0, sql.ErrNoRows
+	}
+
+	err := db.QueryRow("SELECT id FROM schools WHERE facultyadviserId = ?", userId).Scan(&schoolId)
+	if err != sql.ErrNoRows {
+		return schoolId, err
+	}
+
+	query := "SELECT schoolId FROM schoolRoles WHERE userId = ?"
+	if len(permissions) > 0 {
+		query += " AND (" + strings.Join(permissions, " = 1 OR ") + " = 1)"
+	}
+
+	err = db.QueryRow(query, userId).Scan(&schoolId)
+	return schoolId, err
+}
+
+// isAdviser reports whether the user is the faculty adviser of the school.
+func isAdviser(userId int, schoolId int) (bool, error) {
+	if userId == -1 {
+		return false, nil
+	}
+
+	var adviserSchoolId int
+	err := db.QueryRow("SELECT id FROM schools WHERE facultyadviserId = ?", userId).Scan(&adviserSchoolId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return adviserSchoolId == schoolId, nil
+}
+
+// forbidden is the error for a user who isn't allowed to do something. Logged out users are told to log in instead.
+func forbidden(c echo.Context) *apierr.Error {
+	if authentication.GetSession(c).UserID == -1 {
+		return apierr.Unauthorized("logged_out")
+	}
+	return apierr.Forbidden("unauthorized")
+}
+
+// getOfficers returns everyone with a role at the school, club head first.
+func getOfficers(schoolId int) ([]Officer, error) {
+	rows, err := db.Query("SELECT u.id, u.fname, u.lname, u.showsLastname, u.gradeLevel, r.title, r.canPost, r.canManageEvents, r.canManageMembers, r.canManageFinances, r.canManageProfile FROM schoolRoles r INNER JOIN users u ON r.userId = u.id WHERE r.schoolId = ? ORDER BY r.title = ? DESC, r.created", schoolId, ClubHeadTitle)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	officers := []Officer{}
+
+	for rows.Next() {
+		officer := Officer{}
+		var fname, lname string
+		var showsLName, canPost, canManageEvents, canManageMembers, canManageFinances, canManageProfile int
+		gradeLevel := sql.NullInt64{}
+
+		err := rows.Scan(&officer.User.Id, &fname, &lname, &showsLName, &gradeLevel, &officer.Title, &canPost, &canManageEvents, &canManageMembers, &canManageFinances, &canManageProfile)
+		if err != nil {
+			return nil, err
+		}
+
+		if showsLName == 1 {
+			officer.User.Name = fname + " " + lname
+		} else {
+			officer.User.Name = fname
+		}
+		officer.User.GradeLevel = int(gradeLevel.Int64)
+
+		officer.Permissions = Permissions{
+			Post:           canPost == 1,
+			ManageEvents:   canManageEvents == 1,
+			ManageMembers:  canManageMembers == 1,
+			ManageFinances: canManageFinances == 1,
+			ManageProfile:  canManageProfile == 1,
+		}
+
+		officers = append(officers, officer)
+	}
+
+	return officers, rows.Err()
+}
+
+// execer is what the role helpers need from the database, so they can run either on their own or as part of a larger
+// transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// assignRole gives the user a role at the school, replacing any role they already had there.
+func assignRole(q execer, schoolId int, userId int, title string, p Permissions) error {
+	_, err := q.Exec("INSERT INTO schoolRoles (schoolId, userId, title, canPost, canManageEvents, canManageMembers, canManageFinances, canManageProfile, created) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW()) ON DUPLICATE KEY UPDATE title = VALUES(title), canPost = VALUES(canPost), canManageEvents = VALUES(canManageEvents), canManageMembers = VALUES(canManageMembers), canManageFinances = VALUES(canManageFinances), canManageProfile = VALUES(canManageProfile)",
+		schoolId, userId, title, p.Post, p.ManageEvents, p.ManageMembers, p.ManageFinances, p.ManageProfile)
+	return err
+}
+
+// removeRole takes away the user's role at the school. If they were the club head, the school is left without one.
+func removeRole(schoolId int, userId int) error {
+	_, err := db.Exec("DELETE FROM schoolRoles WHERE schoolId = ? AND userId = ?", schoolId, userId)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec("UPDATE schools SET clubheadId = -1 WHERE id = ? AND clubheadId = ?", schoolId, userId)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		err = endClubHeadTerm(db, schoolId)
+		if err != nil {
+			return err
+		}
+
+		publish(schoolId, StreamClubHeadChanged, ClubHeadChange{-1})
+	}
+
+	return nil
+}
+
+// clubHeadHandover is a change of club head that has been saved, and still has to be announced.
+type clubHeadHandover struct {
+	schoolId      int
+	oldClubHeadId int
+	newClubHeadId int
+	schoolName    string
+	displayName   string
+}
+
+// makeClubHead is the club head case of assigning roles. schools.clubheadId is kept up to date as well, since it is
+// still what School.ClubHead shows, and the change is added to the club head history.
+func makeClubHead(schoolId int, userId int, assignedBy int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	handover, err := setClubHead(tx, schoolId, userId, assignedBy)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	handover.announce()
+	return nil
+}
+
+// setClubHead saves a new club head. Once the change is committed, the handover it returns should be announced. It's
+// nil if the user was already club head.
+func setClubHead(q execer, schoolId int, userId int, assignedBy int) (*clubHeadHandover, error) {
+	handover := clubHeadHandover{schoolId: schoolId, newClubHeadId: userId}
+	err := q.QueryRow("SELECT clubheadId, name, displayname FROM schools WHERE id = ?", schoolId).Scan(&handover.oldClubHeadId, &handover.schoolName, &handover.displayName)
+	if err != nil {
+		return nil, err
+	}
+
+	if handover.oldClubHeadId == userId {
+		return nil, nil
+	}
+
+	if handover.oldClubHeadId != -1 {
+		_, err = q.Exec("DELETE FROM schoolRoles WHERE schoolId = ? AND userId = ? AND title = ?", schoolId, handover.oldClubHeadId, ClubHeadTitle)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = assignRole(q, schoolId, userId, ClubHeadTitle, clubHeadPermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = q.Exec("UPDATE schools SET clubheadId = ? WHERE id = ?", userId, schoolId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = endClubHeadTerm(q, schoolId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = q.Exec("INSERT INTO clubHeadHistory (schoolId, userId, assignedBy, started) VALUES (?, ?, ?, NOW())", schoolId, userId, assignedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &handover, nil
+}
+
+// announce tells the school's stream and both club heads about the change.
+func (h *clubHeadHandover) announce() {
+	if h == nil {
+		return
+	}
+
+	publish(h.schoolId, StreamClubHeadChanged, ClubHeadChange{h.newClubHeadId})
+
+	notifyUsers([]int{h.newClubHeadId}, notifications.Notification{
+		Type:  notifications.TypeClubHead,
+		Title: "You were made club head",
+		Body:  "You are now the club head of " + h.schoolName + ".",
+		Link:  "/" + h.displayName,
+	})
+
+	if h.oldClubHeadId != -1 {
+		notifyUsers([]int{h.oldClubHeadId}, notifications.Notification{
+			Type:  notifications.TypeClubHead,
+			Title: "You're no longer club head",
+			Body:  "Someone else has taken over as club head of " + h.schoolName + ".",
+			Link:  "/" + h.displayName,
+		})
+	}
+}
+
+func endClubHeadTerm(q execer, schoolId int) error {
+	_, err := q.Exec("UPDATE clubHeadHistory SET ended = NOW() WHERE schoolId = ? AND ended IS NULL", schoolId)
+	return err
+}
+
+// validOfficerTitle checks a title for a role other than club head. Club heads go through makeClubHead so that
+// schools.clubheadId stays right. Like the column, the limit is in characters rather than bytes.
+func validOfficerTitle(title string) bool {
+	return title != "" && utf8.RuneCountInString(title) <= 64 && title != ClubHeadTitle
+}
+
+type assignRoleRequest struct {
+	UserID         int    `json:"userId" form:"userId" validate:"required"`
+	Title          string `json:"title" form:"title" validate:"required,max=64"`
+	Post           bool   `json:"post" form:"post"`
+	ManageEvents   bool   `json:"manageEvents" form:"manageEvents"`
+	ManageMembers  bool   `json:"manageMembers" form:"manageMembers"`
+	ManageFinances bool   `json:"manageFinances" form:"manageFinances"`
+	ManageProfile  bool   `json:"manageProfile" form:"manageProfile"`
+}
+
+type userIdRequest struct {
+	UserID int `json:"userId" form:"userId" validate:"required"`
+}
+
+type ClubHeadTerm struct {
+	User       User   `json:"user"`
+	AssignedBy User   `json:"assigned_by"`
+	Started    string `json:"started"`
+	Ended      string `json:"ended"`
+}
+
+type ClubHeadHistoryResponse struct {
+	Status string         `json:"status"`
+	Terms  []ClubHeadTerm `json:"terms"`
+}
+
+func ConfigureRoles(e *router) {
+	e.GET("/schools/getClubHeadHistory", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		rows, err := db.Query("SELECT h.started, h.ended, u.id, u.fname, u.lname, u.gradeLevel, a.id, a.fname, a.lname FROM clubHeadHistory h INNER JOIN users u ON h.userId = u.id LEFT OUTER JOIN users a ON h.assignedBy = a.id WHERE h.schoolId = ? ORDER BY h.started DESC, h.id DESC", schoolId)
+		if err != nil {
+			return apierr.Internal("getting club head history", err)
+		}
+
+		defer rows.Close()
+
+		terms := []ClubHeadTerm{}
+
+		for rows.Next() {
+			term := ClubHeadTerm{AssignedBy: User{GradeLevel: -1}}
+			var ended, assignedByFName, assignedByLName sql.NullString
+			var gradeLevel, assignedById sql.NullInt64
+			var fname, lname string
+
+			err := rows.Scan(&term.Started, &ended, &term.User.Id, &fname, &lname, &gradeLevel, &assignedById, &assignedByFName, &assignedByLName)
+			if err != nil {
+				return apierr.Internal("scanning club head history", err)
+			}
+
+			// only leaders see this, so full names are fine
+			term.User.Name = fname + " " + lname
+			term.User.GradeLevel = int(gradeLevel.Int64)
+			term.Ended = ended.String
+
+			term.AssignedBy.Id = -1
+			if assignedById.Valid {
+				term.AssignedBy.Id = int(assignedById.Int64)
+				term.AssignedBy.Name = assignedByFName.String + " " + assignedByLName.String
+			}
+
+			terms = append(terms, term)
+		}
+
+		return c.JSON(http.StatusOK, ClubHeadHistoryResponse{"ok", terms})
+	})
+
+	e.POST("/schools/assignRole", func(c echo.Context) error {
+		request := assignRoleRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		userId := request.UserID
+		title := strings.TrimSpace(request.Title)
+		if !validOfficerTitle(title) {
+			return apierr.Invalid(apierr.Field("title", "invalid_choice"))
+		}
+
+		p := Permissions{
+			Post:           request.Post,
+			ManageEvents:   request.ManageEvents,
+			ManageMembers:  request.ManageMembers,
+			ManageFinances: request.ManageFinances,
+			ManageProfile:  request.ManageProfile,
+		}
+
+		session := authentication.GetSession(c)
+
+		var schoolId, clubHeadId int
+		var schoolName, displayName string
+
+		// only advisers hand out permissions, so officers can't promote themselves
+		err = db.QueryRow("SELECT id, clubheadId, name, displayname from schools WHERE facultyadviserId = ?", session.UserID).Scan(&schoolId, &clubHeadId, &schoolName, &displayName)
+		if err == sql.ErrNoRows || session.UserID == -1 {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		if userId == clubHeadId {
+			return apierr.BadRequest("user_is_club_head")
+		}
+
+		status, err := getMembershipStatus(userId, schoolId)
+		if err != nil {
+			return apierr.Internal("getting membership status", err)
+		}
+		if status != MembershipActive {
+			return apierr.BadRequest("not_a_member")
+		}
+
+		err = assignRole(db, schoolId, userId, title, p)
+		if err != nil {
+			return apierr.Internal("assigning role", err)
+		}
+
+		notifyUsers([]int{userId}, notifications.Notification{
+			Type:  notifications.TypeRoleAssigned,
+			Title: "You're now " + title,
+			Body:  "You were made " + title + " of " + schoolName + ".",
+			Link:  "/" + displayName,
+		})
+
+		return statusOk(c)
+	})
+
+	e.POST("/schools/removeRole", func(c echo.Context) error {
+		request := userIdRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		userId := request.UserID
+		session := authentication.GetSession(c)
+
+		var schoolId int
+
+		err = db.QueryRow("SELECT id from schools WHERE facultyadviserId = ?", session.UserID).Scan(&schoolId)
+		if err == sql.ErrNoRows || session.UserID == -1 {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		err = removeRole(schoolId, userId)
+		if err != nil {
+			return apierr.Internal("removing role", err)
+		}
+
+		return statusOk(c)
+	})
+}
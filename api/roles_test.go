@@ -0,0 +1,27 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidOfficerTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  bool
+	}{
+		{"Treasurer", true},
+		{"", false},
+		{ClubHeadTitle, false},
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 65), false},
+		{strings.Repeat("é", 64), true},
+		{strings.Repeat("é", 65), false},
+	}
+
+	for _, test := range tests {
+		if got := validOfficerTitle(test.title); got != test.want {
+			t.Errorf("validOfficerTitle(%q) = %v, want %v", test.title, got, test.want)
+		}
+	}
+}
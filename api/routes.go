@@ -0,0 +1,470 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/configuration"
+	"github.com/whiskeybrav/studentclubportal-server/export"
+	"github.com/whiskeybrav/studentclubportal-server/ratelimit"
+)
+
+const pathParamsKey = "pathParams"
+
+// maxBodySize is how large a JSON or form body can be.
+const maxBodySize = 1 << 20
+
+// route is one endpoint of the API. Most routes were added before the API was versioned, at paths like
+// /schools/getInvites or /:schoolId/getPosts. Those are still served, but are deprecated in favor of the route's path
+// under /v1.
+type route struct {
+	// legacy is the method and path the route was first added at, like "POST /posts/delete", or empty for routes that
+	// were added with their current path
+	legacy string
+
+	// method and path are where the route lives now. Routes that only exist at their legacy path have no path.
+	method string
+	path   string
+
+	// rename maps path parameters to the field of the request struct they fill in, for structs that call a parameter
+	// by another name. Other path parameters fill in the field of their own name.
+	rename map[string]string
+
+	tag     string
+	summary string
+
+	// request is the struct the handler binds, if it binds one. fields lists the values it reads on its own, like
+	// uploaded files.
+	request interface{}
+	fields  []string
+
+	// response is what the handler sends on success, either a struct sent as JSON or the content type of anything else,
+	// or a list of content types for handlers that can send more than one
+	response interface{}
+
+	// errors lists the error codes the route can respond with, besides internal_server_error and the ones bind uses
+	errors []string
+
+	// csrfExempt routes don't need a CSRF token even though they change something, because the request is authorized
+	// by something it carries, like a signed link, rather than by the session cookie
+	csrfExempt bool
+}
+
+func (r route) key() string {
+	if r.legacy != "" {
+		return r.legacy
+	}
+	return r.method + " " + r.path
+}
+
+// matches says whether name, like "POST /v1/auth/login", is the route's method and path or its legacy ones.
+func (r route) matches(name string) bool {
+	return name == r.legacy || (r.path != "" && name == r.method+" "+r.path)
+}
+
+// needsCSRFToken reports whether requests to the route with the given method have to send a CSRF token.
+func (r route) needsCSRFToken(method string) bool {
+	return !r.csrfExempt && method != http.MethodGet && method != http.MethodHead
+}
+
+// maxBodySize is how large a request to the route can be. Routes that take a file allow the largest upload on top of
+// the usual limit, which leaves room for the other fields.
+func (r route) maxBodySize() int64 {
+	if contains(r.fields, "file") {
+		return maxUploadSize() + maxBodySize
+	}
+	return maxBodySize
+}
+
+// rateLimits are the policies that limit the route, if rate limiting is on.
+func (r route) rateLimits() []configuration.RateLimitPolicy {
+	var policies []configuration.RateLimitPolicy
+	if !config.RateLimit.Enabled {
+		return policies
+	}
+
+	for _, policy := range config.RateLimit.Policies {
+		for _, name := range policy.Routes {
+			if r.matches(name) {
+				policies = append(policies, policy)
+				break
+			}
+		}
+	}
+	return policies
+}
+
+// errorCodes lists every error code the route can respond with, adding the ones that come from bind, middleware or
+// forbidden to its errors.
+func (r route) errorCodes(method string) []string {
+	codes := append([]string{}, r.errors...)
+	if r.tag != "server" {
+		codes = append(codes, "internal_server_error")
+	}
+	if contains(r.errors, "unauthorized") && !contains(r.errors, "logged_out") {
+		codes = append(codes, "logged_out")
+	}
+	if r.request != nil {
+		codes = append(codes, "invalid_params", "unsupported_media_type")
+
+		// Invalid uses these field errors as the code too
+		for _, field := range requestFields(reflect.TypeOf(r.request)) {
+			switch field.schema.Format {
+			case "email":
+				codes = append(codes, "invalid_email")
+			case "password":
+				codes = append(codes, "insecure_password")
+			}
+		}
+	}
+	if r.needsCSRFToken(method) {
+		codes = append(codes, "csrf_token_invalid")
+	}
+	if len(r.rateLimits()) > 0 {
+		codes = append(codes, "rate_limited")
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		codes = append(codes, "request_too_large")
+	}
+	return codes
+}
+
+// legacyRoute splits a route's legacy field into its method and path.
+func (r route) legacyRoute() (string, string) {
+	parts := strings.SplitN(r.legacy, " ", 2)
+	return parts[0], parts[1]
+}
+
+// formName is the request struct field a path parameter fills in.
+func (r route) formName(param string) string {
+	if name, ok := r.rename[param]; ok {
+		return name
+	}
+	return param
+}
+
+var routes = []route{
+	{method: "GET", path: "/", tag: "server", summary: "Get the server version", response: VersionResponse{}},
+	{method: "GET", path: "/teapot", tag: "server", summary: "Brew coffee", errors: []string{"requested_body_is_short_and_stout"}},
+	{method: "GET", path: "/healthz", tag: "server", summary: "Check that the server is running", response: HealthResponse{}},
+	{method: "GET", path: "/readyz", tag: "server", summary: "Check that the server can take requests", response: HealthResponse{}},
+	{method: "GET", path: "/v1/openapi.json", tag: "server", summary: "Get this document", response: "application/json"},
+
+	{legacy: "POST /auth/registerTeacher", method: "POST", path: "/v1/auth/register/teacher", tag: "auth", summary: "Register a teacher account", request: registerTeacherRequest{}, response: StatusResponse{}, errors: []string{"account_exists", "invalid_invite", "invite_for_students", "school_not_found"}},
+	{legacy: "POST /auth/registerStudent", method: "POST", path: "/v1/auth/register/student", tag: "auth", summary: "Register a student account", request: registerStudentRequest{}, response: StatusResponse{}, errors: []string{"account_exists", "invalid_invite", "school_not_found"}},
+	{legacy: "POST /auth/login", method: "POST", path: "/v1/auth/login", tag: "auth", summary: "Log in", request: loginRequest{}, response: LoginResponse{}, errors: []string{"invalid_login"}},
+	{legacy: "POST /auth/logout", method: "POST", path: "/v1/auth/logout", tag: "auth", summary: "Log out", response: StatusResponse{}, errors: []string{"logged_out"}},
+	{legacy: "GET /auth/me", method: "GET", path: "/v1/auth/me", tag: "auth", summary: "Get the logged in user", response: MeResponse{}, errors: []string{"logged_out"}},
+	{legacy: "POST /auth/requestPasswordReset", method: "POST", path: "/v1/auth/password-reset", tag: "auth", summary: "Email a password reset link", request: requestPasswordResetRequest{}, response: StatusResponse{}, errors: []string{"email_not_found"}},
+	{legacy: "POST /auth/resetPassword", method: "POST", path: "/v1/auth/password-reset/complete", tag: "auth", summary: "Reset a password", request: resetPasswordRequest{}, response: StatusResponse{}, errors: []string{"no_reset_available"}},
+
+	{legacy: "POST /schools/register", method: "POST", path: "/v1/schools", tag: "schools", summary: "Register a school and its faculty adviser", request: registerSchoolRequest{}, response: StatusResponse{}, errors: []string{"account_exists", "display_name_already_used"}},
+	{legacy: "GET /schools/search", method: "GET", path: "/v1/schools", tag: "schools", summary: "Search verified schools", request: searchRequest{}, response: SchoolsResponse{}, errors: []string{"search_query_too_short"}},
+	{legacy: "GET /schools/get/:name", method: "GET", path: "/v1/schools/by-name/:name", tag: "schools", summary: "Get a school by its display name, redirecting old names to the current one", response: SchoolResponse{}, errors: []string{"invalid_school", "school_unverified"}},
+	{legacy: "GET /:schoolId/getMembers", method: "GET", path: "/v1/schools/:schoolId/members", tag: "schools", summary: "List a school's members", response: UsersResponse{}, errors: []string{"invalid_params"}},
+	{legacy: "GET /:schoolId/getPosts", method: "GET", path: "/v1/schools/:schoolId/posts", tag: "posts", summary: "List a school's posts", response: PostsResponse{}, errors: []string{"invalid_params"}},
+	{legacy: "GET /:schoolId/getEvents", method: "GET", path: "/v1/schools/:schoolId/events", tag: "events", summary: "List a school's upcoming events", response: EventsResponse{}, errors: []string{"invalid_params"}},
+	{legacy: "GET /:schoolId/getAllEvents", method: "GET", path: "/v1/schools/:schoolId/events/all", tag: "events", summary: "List all of a school's events", response: EventsResponse{}, errors: []string{"invalid_params"}},
+	{legacy: "GET /:schoolId/stream", method: "GET", path: "/v1/schools/:schoolId/stream", tag: "schools", summary: "Stream a school's new posts and events as server-sent events, sending reset if the ones missed since lastEventId can't be caught up on", fields: []string{"lastEventId"}, response: "text/event-stream", errors: []string{"invalid_params", "invalid_school", "school_unverified"}},
+	{legacy: "GET /:schoolId/getDonationProgress", method: "GET", path: "/v1/schools/:schoolId/donation-progress", tag: "donations", summary: "Get a school's progress towards its donation goal", response: DonationProgressResponse{}, errors: []string{"invalid_params", "invalid_school", "school_unverified"}},
+	{legacy: "GET /:schoolId/getCampaigns", method: "GET", path: "/v1/schools/:schoolId/campaigns", tag: "campaigns", summary: "List a school's campaigns", response: CampaignsResponse{}, errors: []string{"invalid_params", "invalid_school", "school_unverified"}},
+
+	{legacy: "POST /schools/update", method: "PATCH", path: "/v1/school", tag: "school", summary: "Change the sent fields of your school's profile", request: updateSchoolRequest{}, response: StatusResponse{}, errors: []string{"display_name_already_used", "invalid_params", "unauthorized"}},
+	{legacy: "GET /schools/getChanges", method: "GET", path: "/v1/school/changes", tag: "school", summary: "List changes to your school's profile", response: SchoolChangesResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "POST /schools/setClubHead", method: "POST", path: "/v1/school/club-head", tag: "school", summary: "Make a member the club head", request: idRequest{}, response: StatusResponse{}, errors: []string{"invalid_club_head", "unauthorized"}},
+	{legacy: "POST /schools/setLogo", method: "PUT", path: "/v1/school/logo", tag: "school", summary: "Set your school's logo to an uploaded image, or remove it if no id is sent", request: setLogoRequest{}, response: StatusResponse{}, errors: []string{"invalid_attachment", "logo_not_image", "unauthorized"}},
+
+	{legacy: "GET /schools/getInvites", method: "GET", path: "/v1/school/invites", tag: "invites", summary: "List your school's invites, leaving out ones that hand out a role unless you're the faculty adviser", response: InvitesResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "POST /schools/createInvite", method: "POST", path: "/v1/school/invites", tag: "invites", summary: "Create an invite to your school", request: createInviteRequest{}, response: InviteResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "POST /schools/revokeInvite", method: "DELETE", path: "/v1/school/invites/:id", tag: "invites", summary: "Revoke an invite. Only the faculty adviser can revoke ones that hand out a role", request: idRequest{}, response: StatusResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "GET /schools/getInvite/:code", method: "GET", path: "/v1/invites/:code", tag: "invites", summary: "Get the school an invite is for", response: LoginResponse{}, errors: []string{"invalid_invite"}},
+	{legacy: "POST /schools/join", method: "POST", path: "/v1/invites/:code/accept", tag: "invites", summary: "Join a school with an invite", request: joinRequest{}, response: LoginResponse{}, errors: []string{"already_member", "invalid_invite", "invite_for_students", "leads_another_school", "logged_out"}},
+
+	{legacy: "GET /schools/getMemberRequests", method: "GET", path: "/v1/school/member-requests", tag: "members", summary: "List students waiting to join your school", response: MemberRequestsResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "POST /schools/approveMember", method: "POST", path: "/v1/school/members/:id/approve", tag: "members", summary: "Let a student join your school", request: idRequest{}, response: StatusResponse{}, errors: []string{"cannot_remove_leader", "membership_not_found", "unauthorized"}},
+	{legacy: "POST /schools/rejectMember", method: "POST", path: "/v1/school/members/:id/reject", tag: "members", summary: "Turn down a student's request to join your school", request: idRequest{}, response: StatusResponse{}, errors: []string{"cannot_remove_leader", "membership_not_found", "unauthorized"}},
+	{legacy: "POST /schools/removeMember", method: "DELETE", path: "/v1/school/members/:id", tag: "members", summary: "Remove a member from your school", request: idRequest{}, response: StatusResponse{}, errors: []string{"cannot_remove_leader", "membership_not_found", "unauthorized"}},
+	{legacy: "POST /schools/importMembers", method: "POST", path: "/v1/school/members/import", tag: "members", summary: "Invite members from a CSV file, or preview the import unless confirm is true", request: importRequest{}, fields: []string{"file"}, response: ImportResponse{}, errors: []string{"invalid_csv", "invalid_params", "too_many_rows", "unauthorized"}},
+	{legacy: "GET /schools/export/members", method: "GET", path: "/v1/school/exports/members", tag: "members", summary: "Export your school's members as CSV or XLSX, chosen with format", fields: []string{"format"}, response: []string{export.ContentTypes[export.FormatCSV], export.ContentTypes[export.FormatXLSX]}, errors: []string{"invalid_params", "unauthorized"}},
+	{legacy: "GET /schools/export/posts", method: "GET", path: "/v1/school/exports/posts", tag: "posts", summary: "Export your school's posts as CSV or XLSX, chosen with format", fields: []string{"format"}, response: []string{export.ContentTypes[export.FormatCSV], export.ContentTypes[export.FormatXLSX]}, errors: []string{"invalid_params", "unauthorized"}},
+	{legacy: "GET /schools/export/events", method: "GET", path: "/v1/school/exports/events", tag: "events", summary: "Export your school's events as CSV or XLSX, chosen with format", fields: []string{"format"}, response: []string{export.ContentTypes[export.FormatCSV], export.ContentTypes[export.FormatXLSX]}, errors: []string{"invalid_params", "unauthorized"}},
+
+	{legacy: "GET /schools/getClubHeadHistory", method: "GET", path: "/v1/school/roles/club-head-history", tag: "roles", summary: "List your school's past club heads", response: ClubHeadHistoryResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "POST /schools/assignRole", method: "POST", path: "/v1/school/roles", tag: "roles", summary: "Give a member an officer role", request: assignRoleRequest{}, response: StatusResponse{}, errors: []string{"not_a_member", "unauthorized", "user_is_club_head"}},
+	{legacy: "POST /schools/removeRole", method: "DELETE", path: "/v1/school/roles/:userId", tag: "roles", summary: "Take away a member's officer role", request: userIdRequest{}, response: StatusResponse{}, errors: []string{"unauthorized"}},
+
+	{legacy: "GET /schools/getAdviserTransfers", method: "GET", path: "/v1/school/adviser-transfers", tag: "advisers", summary: "List transfers of your school's faculty adviser role, or any school's for admins", request: adviserTransfersRequest{}, response: AdviserTransfersResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "POST /schools/nominateAdviser", method: "POST", path: "/v1/school/adviser-transfers", tag: "advisers", summary: "Nominate a teacher to take over as faculty adviser", request: idRequest{}, response: StatusResponse{}, errors: []string{"invalid_nominee", "unauthorized"}},
+	{legacy: "POST /schools/cancelAdviserTransfer", method: "DELETE", path: "/v1/school/adviser-transfers", tag: "advisers", summary: "Cancel a pending adviser transfer", response: StatusResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "POST /schools/acceptAdviser", method: "POST", path: "/v1/adviser-transfers/accept", tag: "advisers", summary: "Accept a nomination to be faculty adviser", request: acceptAdviserRequest{}, response: StatusResponse{}, errors: []string{"invalid_nominee", "logged_out", "no_transfer_available", "unauthorized"}},
+
+	{legacy: "POST /schools/verify", method: "POST", path: "/v1/admin/schools/:schoolId/verify", rename: map[string]string{"schoolId": "id"}, tag: "admin", summary: "Verify a school", request: idRequest{}, response: StatusResponse{}, errors: []string{"invalid_school", "unauthorized"}},
+	{legacy: "POST /admin/setAdviser", method: "POST", path: "/v1/admin/schools/:schoolId/adviser", tag: "admin", summary: "Change a school's faculty adviser", request: setAdviserRequest{}, response: StatusResponse{}, errors: []string{"adviser_changed", "invalid_nominee", "invalid_school", "unauthorized"}},
+
+	{legacy: "POST /posts/new", method: "POST", path: "/v1/posts", tag: "posts", summary: "Post to your school", request: newPostRequest{}, response: StatusResponse{}, errors: []string{"invalid_attachment", "unauthorized"}},
+	{legacy: "POST /posts/delete", method: "DELETE", path: "/v1/posts/:id", tag: "posts", summary: "Delete a post", request: idRequest{}, response: StatusResponse{}, errors: []string{"post_not_found", "unauthorized"}},
+	{legacy: "POST /events/new", method: "POST", path: "/v1/events", tag: "events", summary: "Add an event to your school", request: newEventRequest{}, response: StatusResponse{}, errors: []string{"invalid_attachment", "unauthorized"}},
+	{legacy: "POST /events/delete", method: "DELETE", path: "/v1/events/:id", tag: "events", summary: "Delete an event", request: idRequest{}, response: StatusResponse{}, errors: []string{"event_not_found", "unauthorized"}},
+
+	{legacy: "POST /attachments/upload", method: "POST", path: "/v1/attachments", tag: "attachments", summary: "Upload a file", fields: []string{"file"}, response: AttachmentResponse{}, errors: []string{"file_too_large", "invalid_params", "unauthorized", "unsupported_file_type"}},
+	{legacy: "GET /attachments/:id", method: "GET", path: "/v1/attachments/:id", tag: "attachments", summary: "Download a file", response: "application/octet-stream", errors: []string{"attachment_not_found", "invalid_params"}},
+	{legacy: "POST /attachments/delete", method: "DELETE", path: "/v1/attachments/:id", tag: "attachments", summary: "Delete a file you uploaded", request: idRequest{}, response: StatusResponse{}, errors: []string{"attachment_not_found", "unauthorized"}},
+
+	{legacy: "GET /notifications/get", method: "GET", path: "/v1/notifications", tag: "notifications", summary: "List your notifications", request: notificationsRequest{}, response: NotificationsResponse{}, errors: []string{"logged_out"}},
+	{legacy: "GET /notifications/unreadCount", method: "GET", path: "/v1/notifications/unread-count", tag: "notifications", summary: "Count your unread notifications", response: UnreadCountResponse{}, errors: []string{"logged_out"}},
+	{legacy: "POST /notifications/markRead", method: "POST", path: "/v1/notifications/read", tag: "notifications", summary: "Mark a notification as read, or all of them if all is true", request: markReadRequest{}, response: StatusResponse{}, errors: []string{"logged_out"}},
+	{legacy: "POST /notifications/updatePreferences", method: "PUT", path: "/v1/notifications/preferences", tag: "notifications", summary: "Change which notifications are emailed to you", request: preferencesRequest{}, response: PreferencesResponse{}, errors: []string{"logged_out"}},
+	{legacy: "GET /notifications/unsubscribe", method: "GET", path: "/v1/notifications/unsubscribe", tag: "notifications", summary: "Show a page confirming unsubscribing from a category of emails with a signed link", request: unsubscribeRequest{}, response: "text/html"},
+	{legacy: "POST /notifications/unsubscribe", method: "POST", path: "/v1/notifications/unsubscribe", tag: "notifications", summary: "Unsubscribe from a category of emails in one click (RFC 8058)", request: unsubscribeRequest{}, response: "text/plain", csrfExempt: true},
+	{legacy: "GET /digest/unsubscribe", tag: "notifications", summary: "Show a page confirming unsubscribing from the digest with a link from an old email", request: legacyUnsubscribeRequest{}, response: "text/html"},
+	{legacy: "POST /digest/unsubscribe", tag: "notifications", summary: "Unsubscribe from the digest with a link from an old email", request: legacyUnsubscribeRequest{}, response: "text/plain", csrfExempt: true},
+
+	{legacy: "GET /schools/getDonations", method: "GET", path: "/v1/school/donations", tag: "donations", summary: "List your school's donations", response: DonationsResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "POST /schools/recordDonation", method: "POST", path: "/v1/school/donations", tag: "donations", summary: "Record a donation to your school", request: recordDonationRequest{}, response: StatusResponse{}, errors: []string{"campaign_not_found", "unauthorized"}},
+	{legacy: "POST /schools/voidDonation", method: "POST", path: "/v1/school/donations/:id/void", tag: "donations", summary: "Void a donation that was recorded by mistake", request: voidDonationRequest{}, response: StatusResponse{}, errors: []string{"donation_already_voided", "donation_not_found", "unauthorized"}},
+
+	{legacy: "GET /campaigns/leaderboard", method: "GET", path: "/v1/campaigns/leaderboard", tag: "campaigns", summary: "Rank schools by donations raised between two dates", request: leaderboardRequest{}, response: LeaderboardResponse{}},
+	{legacy: "GET /campaigns/get/:id", method: "GET", path: "/v1/campaigns/:id", tag: "campaigns", summary: "Get a campaign", response: CampaignResponse{}, errors: []string{"campaign_not_found", "invalid_params", "school_unverified"}},
+	{legacy: "POST /campaigns/new", method: "POST", path: "/v1/school/campaigns", tag: "campaigns", summary: "Start a fundraising campaign", request: newCampaignRequest{}, response: CampaignResponse{}, errors: []string{"unauthorized"}},
+	{legacy: "POST /campaigns/delete", method: "DELETE", path: "/v1/school/campaigns/:id", tag: "campaigns", summary: "Delete a campaign, keeping its donations", request: idRequest{}, response: StatusResponse{}, errors: []string{"campaign_not_found", "unauthorized"}},
+}
+
+// router adds each route to echo at its path and its legacy path, as listed in routes. Every route has to be listed
+// there, so that it's documented.
+type router struct {
+	echo       *echo.Echo
+	routes     map[string]route
+	registered map[string]bool
+}
+
+func newRouter(e *echo.Echo) *router {
+	r := &router{
+		echo:       e,
+		routes:     map[string]route{},
+		registered: map[string]bool{},
+	}
+
+	for _, route := range routes {
+		if _, ok := r.routes[route.key()]; ok {
+			panic("api: " + route.key() + " is in the routes table twice")
+		}
+		r.routes[route.key()] = route
+	}
+
+	return r
+}
+
+// ValidateConfig checks the parts of the config that name routes, which the configuration package can't see.
+func ValidateConfig(c configuration.Config) configuration.ValidationErrors {
+	var errs configuration.ValidationErrors
+	for i, policy := range c.RateLimit.Policies {
+		for _, name := range policy.Routes {
+			if !routeExists(name) {
+				errs = append(errs, fmt.Sprintf("rateLimit.policy[%d].routes: %q isn't a route", i, name))
+			}
+		}
+	}
+	return errs
+}
+
+func routeExists(name string) bool {
+	for _, route := range routes {
+		if route.matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *router) GET(path string, h echo.HandlerFunc) {
+	r.add(http.MethodGet, path, h)
+}
+
+func (r *router) POST(path string, h echo.HandlerFunc) {
+	r.add(http.MethodPost, path, h)
+}
+
+// add registers a handler, by the method and path it was first added at.
+func (r *router) add(method, path string, h echo.HandlerFunc) {
+	key := method + " " + path
+	route, ok := r.routes[key]
+	if !ok {
+		panic("api: " + key + " isn't in the routes table")
+	}
+	r.registered[key] = true
+
+	// both paths share the policy's buckets, so switching paths doesn't get around the limit
+	var limits []echo.MiddlewareFunc
+	for _, policy := range route.rateLimits() {
+		limits = append(limits, ratelimit.Middleware(policy))
+	}
+	limits = append(limits, limitBody(route.maxBodySize()))
+
+	if route.legacy != "" {
+		legacyMethod, legacyPath := route.legacyRoute()
+		r.echo.Add(legacyMethod, legacyPath, h, append(limits, deprecated(route))...)
+	}
+
+	if route.path == "" {
+		return
+	}
+
+	middleware := append([]echo.MiddlewareFunc{}, limits...)
+	if strings.Contains(route.path, ":") {
+		middleware = append(middleware, pathParams(route))
+	}
+
+	// not through an echo.Group, which would also add catch-all routes for /v1
+	r.echo.Add(route.method, route.path, h, middleware...)
+}
+
+// check makes sure every route in the table was registered, and that everything echo serves is documented. It returns
+// what doesn't match, which is logged when the server starts and fails the tests.
+func (r *router) check(document openAPIDocument) []string {
+	var problems []string
+
+	for key := range r.routes {
+		if !r.registered[key] {
+			problems = append(problems, key+" is in the routes table but was never added")
+		}
+	}
+
+	for _, echoRoute := range r.echo.Routes() {
+		operations, ok := document.Paths[openAPIPath(echoRoute.Path)]
+		if _, documented := operations[strings.ToLower(echoRoute.Method)]; !ok || !documented {
+			problems = append(problems, echoRoute.Method+" "+echoRoute.Path+" isn't in the OpenAPI document")
+		}
+	}
+
+	for path, operations := range document.Paths {
+		for method := range operations {
+			if !r.serves(strings.ToUpper(method), path) {
+				problems = append(problems, strings.ToUpper(method)+" "+path+" is in the OpenAPI document but isn't served")
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+func (r *router) serves(method, path string) bool {
+	for _, echoRoute := range r.echo.Routes() {
+		if echoRoute.Method == method && openAPIPath(echoRoute.Path) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// deprecated marks responses from a legacy path as deprecated, linking to where the route is now.
+func deprecated(route route) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Response().Header()
+			header.Set("Deprecation", "true")
+
+			if route.path != "" {
+				// fill in whichever parameters the legacy path has, the rest were sent in the body
+				successor := route.path
+				for _, name := range pathParamNames(route.path) {
+					value := c.Param(name)
+					if value == "" {
+						value = "{" + name + "}"
+					} else {
+						value = url.PathEscape(value)
+					}
+					successor = strings.Replace(successor, ":"+name, value, 1)
+				}
+
+				header.Set("Link", "<"+successor+">; rel=\"successor-version\"")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// limitedBody notices when a request body goes over its http.MaxBytesReader limit.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// limitBody stops reading request bodies after limit bytes, before they're parsed, and responds with
+// request_too_large. Whatever error the handler got from the cut off body is replaced, since bind and echo report it
+// as a bad request.
+func limitBody(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.ContentLength > limit {
+				return apierr.New(http.StatusRequestEntityTooLarge, "request_too_large")
+			}
+
+			body := &limitedBody{ReadCloser: http.MaxBytesReader(c.Response(), req.Body, limit)}
+			req.Body = body
+
+			err := next(c)
+			if err != nil && body.exceeded {
+				return apierr.New(http.StatusRequestEntityTooLarge, "request_too_large")
+			}
+			return err
+		}
+	}
+}
+
+// pathParams hands a route's path parameters to bind, by the form names the request structs shared with legacy paths
+// use for them.
+func pathParams(route route) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			params := map[string]string{}
+			for _, name := range c.ParamNames() {
+				params[route.formName(name)] = c.Param(name)
+			}
+			c.Set(pathParamsKey, params)
+
+			return next(c)
+		}
+	}
+}
+
+// IsCSRFExempt reports whether the request is to a route that doesn't need a CSRF token. It has to run after routing.
+func IsCSRFExempt(c echo.Context) bool {
+	name := c.Request().Method + " " + c.Path()
+	for _, route := range routes {
+		if route.matches(name) {
+			return route.csrfExempt
+		}
+	}
+	return false
+}
+
+// pathParamNames lists the parameters in an echo path, like schoolId in /v1/schools/:schoolId/posts.
+func pathParamNames(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") {
+			names = append(names, segment[1:])
+		}
+	}
+	return names
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/configuration"
+)
+
+// configureForTest adds every route to a bare echo.
+func configureForTest(t *testing.T) *echo.Echo {
+	t.Helper()
+
+	defaults := configuration.Defaults()
+	e := echo.New()
+	Configure(e, &defaults, nil)
+	return e
+}
+
+func TestRoutesMatchOpenAPIDocument(t *testing.T) {
+	e := configureForTest(t)
+	document := buildOpenAPIDocument()
+
+	served := map[string]bool{}
+	for _, echoRoute := range e.Routes() {
+		key := strings.ToLower(echoRoute.Method) + " " + openAPIPath(echoRoute.Path)
+		served[key] = true
+
+		if _, ok := document.Paths[openAPIPath(echoRoute.Path)][strings.ToLower(echoRoute.Method)]; !ok {
+			t.Errorf("%s %s is served but isn't in the OpenAPI document", echoRoute.Method, echoRoute.Path)
+		}
+	}
+
+	for path, operations := range document.Paths {
+		for method := range operations {
+			if !served[method+" "+path] {
+				t.Errorf("%s %s is in the OpenAPI document but isn't served", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestRouterCheck(t *testing.T) {
+	defaults := configuration.Defaults()
+	config = &defaults
+
+	r := newRouter(echo.New())
+	addRoutes(r)
+	if problems := r.check(buildOpenAPIDocument()); len(problems) > 0 {
+		t.Errorf("check found problems with the routes:\n%s", strings.Join(problems, "\n"))
+	}
+
+	partial := newRouter(echo.New())
+	partial.GET("/", func(c echo.Context) error { return nil })
+	if problems := partial.check(buildOpenAPIDocument()); len(problems) == 0 {
+		t.Error("check didn't notice routes that were never added")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	defaults := configuration.Defaults()
+	if errs := ValidateConfig(defaults); len(errs) > 0 {
+		t.Errorf("the default config has problems: %v", errs)
+	}
+
+	defaults.RateLimit.Policies = append(defaults.RateLimit.Policies, configuration.RateLimitPolicy{
+		Name:   "typo",
+		Routes: []string{"POST /v1/auth/login", "POST /v1/auth/logn"},
+	})
+	errs := ValidateConfig(defaults)
+	if len(errs) != 1 || !strings.Contains(errs[0], "POST /v1/auth/logn") {
+		t.Errorf("ValidateConfig returned %v, want a problem with POST /v1/auth/logn", errs)
+	}
+}
+
+// errorConstructor is an apierr function that takes an error code.
+type errorConstructor struct {
+	// arg is which argument is the code.
+	arg int
+	// status is the status it responds with, or 0 if that's an argument too.
+	status int
+}
+
+var errorConstructors = map[string]errorConstructor{
+	"BadRequest":   {0, http.StatusBadRequest},
+	"Unauthorized": {0, http.StatusUnauthorized},
+	"Forbidden":    {0, http.StatusForbidden},
+	"NotFound":     {0, http.StatusNotFound},
+	"Conflict":     {0, http.StatusConflict},
+	"New":          {1, 0},
+}
+
+// handlerCodes finds the error codes used in a function, including in the package's functions it calls. Codes built
+// with a status that doesn't match apierr.Codes are added to wrongStatus.
+type handlerCodes struct {
+	fset        *token.FileSet
+	funcs       map[string]*ast.FuncDecl
+	seen        map[string]bool
+	wrongStatus map[string]bool
+}
+
+func (h *handlerCodes) codes(node ast.Node) []string {
+	var codes []string
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		switch fun := call.Fun.(type) {
+		case *ast.SelectorExpr:
+			pkg, ok := fun.X.(*ast.Ident)
+			if !ok || pkg.Name != "apierr" {
+				return true
+			}
+
+			if fun.Sel.Name == "Invalid" {
+				codes = append(codes, "invalid_params")
+				return true
+			}
+
+			constructor, ok := errorConstructors[fun.Sel.Name]
+			if !ok || len(call.Args) <= constructor.arg {
+				return true
+			}
+			if lit, ok := call.Args[constructor.arg].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				code, _ := strconv.Unquote(lit.Value)
+				codes = append(codes, code)
+
+				if info, known := apierr.Codes[code]; known && constructor.status != 0 && constructor.status != info.Status {
+					h.wrongStatus[fmt.Sprintf("%s: apierr.%s(%q) responds with %d, but apierr.Codes says %d", h.fset.Position(call.Pos()), fun.Sel.Name, code, constructor.status, info.Status)] = true
+				}
+			}
+		case *ast.Ident:
+			decl, ok := h.funcs[fun.Name]
+			if ok && !h.seen[fun.Name] {
+				h.seen[fun.Name] = true
+				codes = append(codes, h.codes(decl.Body)...)
+				delete(h.seen, fun.Name)
+			}
+		}
+		return true
+	})
+
+	return codes
+}
+
+func TestHandlerErrorsAreDocumented(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	h := &handlerCodes{fset: fset, funcs: map[string]*ast.FuncDecl{}, seen: map[string]bool{}, wrongStatus: map[string]bool{}}
+	var parsed []*ast.File
+
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+
+		source, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := parser.ParseFile(fset, name, source, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, file)
+
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				h.funcs[fn.Name.Name] = fn
+			}
+		}
+	}
+
+	byKey := map[string]route{}
+	for _, route := range routes {
+		byKey[route.key()] = route
+	}
+
+	handlers := 0
+	for _, file := range parsed {
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) != 2 {
+				return true
+			}
+
+			fun, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || (fun.Sel.Name != "GET" && fun.Sel.Name != "POST") {
+				return true
+			}
+
+			path, ok := call.Args[0].(*ast.BasicLit)
+			handler, isFunc := call.Args[1].(*ast.FuncLit)
+			if !ok || !isFunc {
+				return true
+			}
+
+			unquoted, _ := strconv.Unquote(path.Value)
+			key := fun.Sel.Name + " " + unquoted
+			route, ok := byKey[key]
+			if !ok {
+				t.Errorf("%s: %s isn't in the routes table", fset.Position(call.Pos()), key)
+				return true
+			}
+			handlers++
+
+			allowed := map[string]bool{}
+			for _, code := range route.errorCodes(fun.Sel.Name) {
+				allowed[code] = true
+			}
+
+			var missing []string
+			for _, code := range h.codes(handler.Body) {
+				if _, known := apierr.Codes[code]; !known {
+					t.Errorf("%s: %s uses %s, which isn't in apierr.Codes", fset.Position(call.Pos()), key, code)
+				}
+				if !allowed[code] && !contains(missing, code) {
+					missing = append(missing, code)
+				}
+			}
+
+			if len(missing) > 0 {
+				sort.Strings(missing)
+				t.Errorf("%s: %s can respond with %s, which its errors don't list", fset.Position(call.Pos()), key, strings.Join(missing, ", "))
+			}
+			return true
+		})
+	}
+
+	for problem := range h.wrongStatus {
+		t.Error(problem)
+	}
+
+	if handlers != len(routes) {
+		t.Errorf("found %d handlers, but there are %d routes", handlers, len(routes))
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		want          int
+	}{
+		{"under the limit", `{"id":1}`, 8, http.StatusOK},
+		{"declared over the limit", `{"id":1234567890}`, 17, http.StatusRequestEntityTooLarge},
+		{"streamed over the limit", `{"id":1234567890}`, -1, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = apierr.Handler
+			e.POST("/", func(c echo.Context) error {
+				request := idRequest{}
+				err := bind(c, &request)
+				if err != nil {
+					return err
+				}
+				return statusOk(c)
+			}, limitBody(10))
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.ContentLength = test.contentLength
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != test.want {
+				t.Errorf("got %d, want %d: %s", rec.Code, test.want, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+)
+
+type SchoolChange struct {
+	User     User   `json:"user"`
+	Field    string `json:"field"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+	Changed  string `json:"changed"`
+}
+
+type SchoolChangesResponse struct {
+	Status  string         `json:"status"`
+	Changes []SchoolChange `json:"changes"`
+}
+
+// displayNameTaken checks whether a display name is in use by a school, either now or as an old name that still
+// redirects.
+func displayNameTaken(displayName string) (bool, error) {
+	count := 0
+	err := db.QueryRow("SELECT (SELECT COUNT(*) FROM schools WHERE displayname = ?) + (SELECT COUNT(*) FROM schoolAliases WHERE displayname = ?)", displayName, displayName).Scan(&count)
+	return count > 0, err
+}
+
+// updateSchoolRequest holds the profile fields to change. Fields that aren't sent are left as they are, so they're
+// pointers, and their rules only apply when they're sent.
+type updateSchoolRequest struct {
+	DisplayName  *string  `json:"displayname" form:"displayname" validate:"required,letters,max=255"`
+	Name         *string  `json:"name" form:"name" validate:"required,max=255"`
+	Website      *string  `json:"website" form:"website" validate:"required,url"`
+	City         *string  `json:"city" form:"city" validate:"required,max=255"`
+	State        *string  `json:"state" form:"state" validate:"required,state"`
+	Address      *string  `json:"address" form:"address" validate:"required,max=255"`
+	DriveFolder  *string  `json:"driveFolder" form:"driveFolder" validate:"required,url"`
+	DonationGoal *float64 `json:"donationGoal" form:"donationGoal" validate:"min=0"`
+}
+
+// profileChange is a new value for a school column. The column names are never taken from the request.
+type profileChange struct {
+	column string
+	value  *string
+}
+
+func ConfigureSchoolProfile(e *router) {
+	e.POST("/schools/update", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID, PermissionManageProfile)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		request := updateSchoolRequest{}
+		err = bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		current := map[string]string{}
+		var displayName, name, website, city, state, address, driveFolder string
+		var donationGoal float64
+
+		err = db.QueryRow("SELECT displayname, name, website, city, state, address, driveFolder, donationGoal FROM schools WHERE id = ?", schoolId).Scan(&displayName, &name, &website, &city, &state, &address, &driveFolder, &donationGoal)
+		if err != nil {
+			return apierr.Internal("getting school to update", err)
+		}
+
+		current["displayname"] = displayName
+		current["name"] = name
+		current["website"] = website
+		current["city"] = city
+		current["state"] = state
+		current["address"] = address
+		current["driveFolder"] = driveFolder
+		current["donationGoal"] = strconv.FormatFloat(donationGoal, 'f', -1, 64)
+
+		if request.DisplayName != nil {
+			*request.DisplayName = strings.ToLower(*request.DisplayName)
+		}
+		if request.State != nil {
+			*request.State = strings.ToUpper(*request.State)
+		}
+
+		sent := []profileChange{
+			{"displayname", request.DisplayName},
+			{"name", request.Name},
+			{"website", request.Website},
+			{"city", request.City},
+			{"state", request.State},
+			{"address", request.Address},
+			{"driveFolder", request.DriveFolder},
+		}
+		if request.DonationGoal != nil {
+			goal := strconv.FormatFloat(*request.DonationGoal, 'f', -1, 64)
+			sent = append(sent, profileChange{"donationGoal", &goal})
+		}
+
+		var changed []string
+		updated := map[string]string{}
+
+		for _, change := range sent {
+			if change.value == nil || *change.value == current[change.column] {
+				continue
+			}
+
+			changed = append(changed, change.column)
+			updated[change.column] = *change.value
+		}
+
+		if len(changed) == 0 {
+			return statusOk(c)
+		}
+
+		if newName, ok := updated["displayname"]; ok {
+			// going back to one of this school's own old names is fine
+			var aliasSchoolId int
+			aliasErr := db.QueryRow("SELECT schoolId FROM schoolAliases WHERE displayname = ?", newName).Scan(&aliasSchoolId)
+
+			if aliasErr != nil || aliasSchoolId != schoolId {
+				taken, err := displayNameTaken(newName)
+				if err != nil {
+					return apierr.Internal("seeing if display name is used", err)
+				}
+				if taken {
+					return apierr.Conflict("display_name_already_used").WithFields(apierr.Field("displayname", "display_name_already_used"))
+				}
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return apierr.Internal("starting school update", err)
+		}
+
+		defer tx.Rollback()
+
+		for _, column := range changed {
+			_, err = tx.Exec("UPDATE schools SET "+column+" = ? WHERE id = ?", updated[column], schoolId)
+			if err != nil {
+				return apierr.Internal("updating school", err)
+			}
+
+			_, err = tx.Exec("INSERT INTO schoolChanges (schoolId, userId, field, oldValue, newValue, changed) VALUES (?, ?, ?, ?, ?, NOW())", schoolId, session.UserID, column, current[column], updated[column])
+			if err != nil {
+				return apierr.Internal("recording school change", err)
+			}
+		}
+
+		if newName, ok := updated["displayname"]; ok {
+			_, err = tx.Exec("DELETE FROM schoolAliases WHERE displayname = ? AND schoolId = ?", newName, schoolId)
+			if err != nil {
+				return apierr.Internal("removing school alias", err)
+			}
+
+			_, err = tx.Exec("INSERT INTO schoolAliases (displayname, schoolId, created) VALUES (?, ?, NOW())", current["displayname"], schoolId)
+			if err != nil {
+				return apierr.Internal("adding school alias", err)
+			}
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return apierr.Internal("committing school update", err)
+		}
+
+		return statusOk(c)
+	})
+
+	e.GET("/schools/getChanges", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		schoolId, err := schoolWithPermission(session.UserID)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		rows, err := db.Query("SELECT c.field, c.oldValue, c.newValue, c.changed, u.id, u.fname, u.lname FROM schoolChanges c INNER JOIN users u ON c.userId = u.id WHERE c.schoolId = ? ORDER BY c.changed DESC, c.id DESC", schoolId)
+		if err != nil {
+			return apierr.Internal("getting school changes", err)
+		}
+
+		defer rows.Close()
+
+		changes := []SchoolChange{}
+
+		for rows.Next() {
+			change := SchoolChange{User: User{GradeLevel: -1}}
+			var fname, lname string
+
+			err := rows.Scan(&change.Field, &change.OldValue, &change.NewValue, &change.Changed, &change.User.Id, &fname, &lname)
+			if err != nil {
+				return apierr.Internal("scanning school change", err)
+			}
+
+			change.User.Name = fname + " " + lname
+
+			changes = append(changes, change)
+		}
+
+		return c.JSON(http.StatusOK, SchoolChangesResponse{"ok", changes})
+	})
+}
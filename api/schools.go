@@ -1,17 +1,21 @@
 package api
 
 import (
+	"database/sql"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"unicode"
 
 	"github.com/NoteToScreen/maily-go/maily"
 	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
 	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
-	"github.com/whiskeybrav/studentclubportal-server/errlog"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
 	"github.com/whiskeybrav/studentclubportal-server/mail"
-	"github.com/whiskeybrav/studentclubportal-server/util"
+	"github.com/whiskeybrav/studentclubportal-server/metrics"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -26,20 +30,22 @@ type SchoolsResponse struct {
 }
 
 type School struct {
-	Id              int     `json:"id"`
-	DisplayName     string  `json:"display_name"`
-	Name            string  `json:"name"`
-	Website         string  `json:"website"`
-	DonationsRaised float64 `json:"donations_raised"`
-	DonationGoal    float64 `json:"donation_goal"`
-	FoundedDate     string  `json:"founded_date"`
-	City            string  `json:"city"`
-	State           string  `json:"state"`
-	Address         string  `json:"address"`
-	DriveFolder     string  `json:"drive_folder"`
-	ClubHead        User    `json:"club_head"`
-	FacultyAdviser  User    `json:"faculty_adviser"`
-	IsVerified      bool    `json:"is_verified"`
+	Id              int       `json:"id"`
+	DisplayName     string    `json:"display_name"`
+	Name            string    `json:"name"`
+	Website         string    `json:"website"`
+	DonationsRaised float64   `json:"donations_raised"`
+	DonationGoal    float64   `json:"donation_goal"`
+	FoundedDate     string    `json:"founded_date"`
+	City            string    `json:"city"`
+	State           string    `json:"state"`
+	Address         string    `json:"address"`
+	DriveFolder     string    `json:"drive_folder"`
+	ClubHead        User      `json:"club_head"`
+	FacultyAdviser  User      `json:"faculty_adviser"`
+	IsVerified      bool      `json:"is_verified"`
+	Logo            string    `json:"logo"`
+	Officers        []Officer `json:"officers"`
 }
 
 type User struct {
@@ -53,144 +59,259 @@ type UsersResponse struct {
 	Users  []User `json:"users"`
 }
 
-func ConfigureSchools(e *echo.Echo) {
-	e.POST("/schools/register", func(c echo.Context) error {
-		if c.FormValue("fname") == "" || c.FormValue("lname") == "" || c.FormValue("email") == "" || c.FormValue("password") == "" {
-			// These are the things that we need to register the teacher
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
-		}
+type registerSchoolRequest struct {
+	FirstName   string `json:"fname" form:"fname" validate:"required,max=255"`
+	LastName    string `json:"lname" form:"lname" validate:"required,max=255"`
+	Email       string `json:"email" form:"email" validate:"required,email"`
+	Password    string `json:"password" form:"password" validate:"required,password"`
+	DisplayName string `json:"displayname" form:"displayname" validate:"required,letters,max=255"`
+	Name        string `json:"name" form:"name" validate:"required,max=255"`
+	Website     string `json:"website" form:"website" validate:"required,url"`
+	City        string `json:"city" form:"city" validate:"required,max=255"`
+	State       string `json:"state" form:"state" validate:"required,state"`
+	Address     string `json:"address" form:"address" validate:"required,max=255"`
+	DriveFolder string `json:"driveFolder" form:"driveFolder" validate:"url"`
+}
 
-		if c.FormValue("displayname") == "" || !isLetter(c.FormValue("displayname")) || c.FormValue("name") == "" || c.FormValue("website") == "" || c.FormValue("city") == "" || len(c.FormValue("state")) != 2 || c.FormValue("address") == "" {
-			// These are the things that we need to register the school
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
-		}
+type idRequest struct {
+	ID int `json:"id" form:"id" validate:"required"`
+}
 
-		if !util.EmailIsValid(c.FormValue("email")) {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_email"})
-		}
+// setLogoRequest removes the logo if no id is sent.
+type setLogoRequest struct {
+	ID int `json:"id" form:"id"`
+}
+
+type searchRequest struct {
+	Q string `json:"q" form:"q"`
+}
 
-		if !authentication.ValidatePassword(c.FormValue("password")) {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "insecure_password"})
+func ConfigureSchools(e *router) {
+	e.POST("/schools/register", func(c echo.Context) error {
+		request := registerSchoolRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
 		}
 
+		// display names are used in URLs, which are lowercase
+		request.DisplayName = strings.ToLower(request.DisplayName)
+
 		empty := ""
 
-		acctExistsErr := db.QueryRow("SELECT id FROM users WHERE email = ?", c.FormValue("email")).Scan(&empty)
+		acctExistsErr := db.QueryRow("SELECT id FROM users WHERE email = ?", request.Email).Scan(&empty)
 
 		if acctExistsErr == nil {
 			// the account already exists
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "account_exists"})
+			return apierr.BadRequest("account_exists")
 		}
 
-		rows, err := db.Query("SELECT * FROM schools WHERE displayname = ?", c.FormValue("displayname"))
+		taken, err := displayNameTaken(request.DisplayName)
 		if err != nil {
-			errlog.LogError("seeing if display name is used", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("seeing if display name is used", err)
 		}
 
-		if rows.Next() {
+		if taken {
 			// display name used :'(
-			return c.JSON(http.StatusConflict, ErrorResponse{"error", "display_name_already_used"})
+			return apierr.Conflict("display_name_already_used")
 		}
-		err = rows.Close()
-		if err != nil {
-			// I think this error would be non-fatal
-			errlog.LogError("closing rows (nonfatal)", err)
-			err = nil
-		}
-
-		_, err = db.Exec("INSERT INTO schools (displayname, name, clubheadId, facultyadviserId, website, donationsRaised, foundedDate, city, state, address, driveFolder, donationGoal, isVerified) VALUES (?, ?, -1, -1, ?, 0, NOW(), ?, ?, ?, ?, 0, -1)",
-			strings.ToLower(c.FormValue("displayname")),
-			c.FormValue("name"),
-			c.FormValue("website"),
-			c.FormValue("city"),
-			c.FormValue("state"),
-			c.FormValue("address"),
-			"https://drive.google.com",
+
+		_, err = db.Exec("INSERT INTO schools (displayname, name, clubheadId, facultyadviserId, website, foundedDate, city, state, address, driveFolder, donationGoal, isVerified) VALUES (?, ?, -1, -1, ?, NOW(), ?, ?, ?, ?, 0, -1)",
+			request.DisplayName,
+			request.Name,
+			request.Website,
+			request.City,
+			strings.ToUpper(request.State),
+			request.Address,
+			request.DriveFolder,
 		)
 		if err != nil {
-			errlog.LogError("creating school", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("creating school", err)
 		}
 
 		schoolId := 0
 
-		err = db.QueryRow("SELECT id FROM schools WHERE displayname = ?", c.FormValue("displayname")).Scan(&schoolId)
+		err = db.QueryRow("SELECT id FROM schools WHERE displayname = ?", request.DisplayName).Scan(&schoolId)
 		if err != nil {
-			errlog.LogError("getting id of new school", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting id of new school", err)
 		}
 
-		pwd, err := bcrypt.GenerateFromPassword([]byte(c.FormValue("password")), bcrypt.DefaultCost)
+		pwd, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
 		if err != nil {
-			errlog.LogError("generating password hash", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("generating password hash", err)
 		}
 
-		_, err = db.Exec("INSERT INTO users (fname, lname, email, password, schoolId, type, userLevel, registration) VALUES (?, ?, ?, ?, ?, ?, 0, NOW())", c.FormValue("fname"), c.FormValue("lname"), c.FormValue("email"), string(pwd), schoolId, UserTypeTeacher)
+		_, err = db.Exec("INSERT INTO users (fname, lname, email, password, schoolId, type, userLevel, registration) VALUES (?, ?, ?, ?, ?, ?, 0, NOW())", request.FirstName, request.LastName, request.Email, string(pwd), schoolId, UserTypeTeacher)
 		if err != nil {
-			errlog.LogError("adding user to db", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("adding user to db", err)
 		}
 
+		metrics.Registered("teacher")
+
 		session := c.Get("session").(authentication.SessionInfo)
 
-		err = db.QueryRow("SELECT id FROM users WHERE email = ?", c.FormValue("email")).Scan(&session.UserID)
+		err = db.QueryRow("SELECT id FROM users WHERE email = ?", request.Email).Scan(&session.UserID)
 		if err != nil {
-			errlog.LogError("getting new user id from DB", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting new user id from DB", err)
 		}
 
 		err = authentication.SetSession(session)
 		if err != nil {
-			errlog.LogError("setting new user's id", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("setting new user's id", err)
 		}
 
-		_, err = db.Exec("UPDATE schools SET facultyadviserId = ? WHERE displayname = ?", session.UserID, c.FormValue("displayname"))
+		_, err = db.Exec("UPDATE schools SET facultyadviserId = ? WHERE displayname = ?", session.UserID, request.DisplayName)
+
+		err = requestMembership(session.UserID, schoolId, MembershipActive)
+		if err != nil {
+			logging.FromContext(c).Error("adding adviser membership", err)
+		}
 
-		_, err = mail.Mail.SendMail(config.Mail.AdminName, config.Mail.AdminEmail, "newSchool", maily.TemplateData{}, maily.FuncMap{}, maily.FuncMap{})
+		err = mail.Send(config.Mail.AdminName, config.Mail.AdminEmail, "newSchool", maily.TemplateData{})
 		if err != nil {
-			errlog.LogError("sending admin registration email", err)
+			logging.FromContext(c).Error("sending admin registration email", err)
 		}
 
 		return statusOk(c)
 	})
 
 	e.POST("/schools/setClubHead", func(c echo.Context) error {
-		newClubHeadId, err := strconv.Atoi(c.FormValue("id"))
+		request := idRequest{}
+		err := bind(c, &request)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "invalid_params"})
+			return err
 		}
 
+		newClubHeadId := request.ID
+
 		session := authentication.GetSession(c)
 
 		var schoolId int
 
 		err = db.QueryRow("SELECT id from schools WHERE facultyadviserId = ?", session.UserID).Scan(&schoolId)
+		if err == sql.ErrNoRows || session.UserID == -1 {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		ok, err := checkMember(newClubHeadId, schoolId, UserTypeStudent)
 		if err != nil {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "unauthorized"})
+			return apierr.Internal("checking new club head", err)
+		}
+		if !ok {
+			// club heads have to be students who are already on the roster
+			return apierr.BadRequest("invalid_club_head")
 		}
 
-		_, err = db.Exec("UPDATE schools SET clubheadId = ? WHERE id = ?", newClubHeadId, schoolId)
+		err = makeClubHead(schoolId, newClubHeadId, session.UserID)
 		if err != nil {
-			errlog.LogError("updating club head", err)
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("updating club head", err)
 		}
 
 		return statusOk(c)
 	})
 
+	e.POST("/schools/setLogo", func(c echo.Context) error {
+		session := authentication.GetSession(c)
+
+		// the logo is shown next to every post, so officers who can post may change it
+		schoolId, err := schoolWithPermission(session.UserID, PermissionPost)
+		if err == sql.ErrNoRows {
+			return forbidden(c)
+		}
+		if err != nil {
+			return apierr.Internal("checking permissions", err)
+		}
+
+		request := setLogoRequest{}
+		err = bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		if request.ID == 0 {
+			_, err = db.Exec("UPDATE schools SET logoId = NULL WHERE id = ?", schoolId)
+			if err != nil {
+				return apierr.Internal("removing school logo", err)
+			}
+			return statusOk(c)
+		}
+
+		attachmentId := request.ID
+
+		var attachmentSchoolId int
+		var mimeType string
+
+		err = db.QueryRow("SELECT schoolId, mimeType FROM attachments WHERE id = ?", attachmentId).Scan(&attachmentSchoolId, &mimeType)
+		if err != nil || attachmentSchoolId != schoolId {
+			return apierr.BadRequest("invalid_attachment")
+		}
+
+		if !isImage(mimeType) {
+			return apierr.BadRequest("logo_not_image")
+		}
+
+		_, err = db.Exec("UPDATE schools SET logoId = ? WHERE id = ?", attachmentId, schoolId)
+		if err != nil {
+			return apierr.Internal("setting school logo", err)
+		}
+
+		return statusOk(c)
+	})
+
+	e.POST("/schools/verify", func(c echo.Context) error {
+		request := idRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		schoolId := request.ID
+		session := authentication.GetSession(c)
+
+		if !isAdmin(session.UserID) {
+			return forbidden(c)
+		}
+
+		var schoolName, displayName string
+		var clubHeadId, facultyAdviserId int
+
+		err = db.QueryRow("SELECT name, displayname, clubheadId, facultyadviserId FROM schools WHERE id = ?", schoolId).Scan(&schoolName, &displayName, &clubHeadId, &facultyAdviserId)
+		if err != nil {
+			return apierr.NotFound("invalid_school")
+		}
+
+		_, err = db.Exec("UPDATE schools SET isVerified = 1 WHERE id = ?", schoolId)
+		if err != nil {
+			return apierr.Internal("verifying school", err)
+		}
+
+		leaders := []int{facultyAdviserId}
+		if clubHeadId != -1 {
+			leaders = append(leaders, clubHeadId)
+		}
+
+		notifyUsers(leaders, notifications.Notification{
+			Type:  notifications.TypeSchoolVerified,
+			Title: "Your school was approved",
+			Body:  schoolName + " has been approved and is now visible to everyone.",
+			Link:  "/" + displayName,
+		})
+
+		return statusOk(c)
+	})
+
 	e.GET("/:schoolId/getMembers", func(c echo.Context) error {
 		schoolId, err := strconv.Atoi(c.Param("schoolId"))
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "invalid_params"})
+			return apierr.BadRequest("invalid_params")
 		}
 
-		rows, err := db.Query("SELECT id, fname, lname, showsLastname, gradeLevel FROM users WHERE schoolId = ?", schoolId)
+		rows, err := db.Query("SELECT u.id, u.fname, u.lname, u.showsLastname, u.gradeLevel FROM users u INNER JOIN memberships m ON m.userId = u.id WHERE m.schoolId = ? AND m.status = ?", schoolId, MembershipActive)
 		if err != nil {
-			errlog.LogError("getting events", err)
-			return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+			return apierr.Internal("getting events", err)
 		}
 
 		defer rows.Close()
@@ -205,8 +326,7 @@ func ConfigureSchools(e *echo.Echo) {
 
 			err := rows.Scan(&user.Id, &fname, &lname, &showsLName, &user.GradeLevel)
 			if err != nil {
-				errlog.LogError("scanning event", err)
-				return c.JSON(http.StatusInternalServerError, ErrorResponse{"error", "internal_server_error"})
+				return apierr.Internal("scanning event", err)
 			}
 
 			if showsLName == 1 {
@@ -222,7 +342,7 @@ func ConfigureSchools(e *echo.Echo) {
 	})
 
 	e.GET("/schools/get/:name", func(c echo.Context) error {
-		row := db.QueryRow("SELECT s.id, s.displayname, s.name, s.website, s.donationsRaised, s.donationGoal, s.foundedDate, s.city, s.state, s.address, s.driveFolder, s.isVerified, s.clubheadId, ch.fname, ch.showsLastname, ch.lname, ch.gradeLevel, fa.id, fa.fname, fa.lname FROM schools s LEFT OUTER JOIN users ch ON s.clubheadId = ch.id INNER JOIN users fa ON s.facultyadviserId = fa.id WHERE displayname = ?;", c.Param("name"))
+		row := db.QueryRow("SELECT s.id, s.displayname, s.name, s.website, "+donationsRaisedSQL+", s.donationGoal, s.foundedDate, s.city, s.state, s.address, s.driveFolder, s.isVerified, s.logoId, s.clubheadId, ch.fname, ch.showsLastname, ch.lname, ch.gradeLevel, fa.id, fa.fname, fa.lname FROM schools s LEFT OUTER JOIN users ch ON s.clubheadId = ch.id INNER JOIN users fa ON s.facultyadviserId = fa.id WHERE displayname = ?;", c.Param("name"))
 
 		facultyAdviser := User{GradeLevel: -1}
 		clubHead := User{}
@@ -234,6 +354,7 @@ func ConfigureSchools(e *echo.Echo) {
 		adviserLName := ""
 
 		isVerifiedInt := 0
+		logoId := sql.NullInt64{}
 
 		err := row.Scan(
 			&school.Id,
@@ -248,6 +369,7 @@ func ConfigureSchools(e *echo.Echo) {
 			&school.Address,
 			&school.DriveFolder,
 			&isVerifiedInt,
+			&logoId,
 			&clubHead.Id,
 			&clubHeadFName,
 			&clubHeadLNameShown,
@@ -258,8 +380,21 @@ func ConfigureSchools(e *echo.Echo) {
 			&adviserLName,
 		)
 
+		if err == sql.ErrNoRows {
+			// the school might have been renamed, in which case the old name still leads to it
+			newName := ""
+			aliasErr := db.QueryRow("SELECT s.displayname FROM schoolAliases a INNER JOIN schools s ON a.schoolId = s.id WHERE a.displayname = ?", c.Param("name")).Scan(&newName)
+			if aliasErr == nil {
+				// the same route is served at more than one path, so redirect to whichever one was used
+				return c.Redirect(http.StatusMovedPermanently, strings.TrimSuffix(c.Path(), ":name")+url.PathEscape(newName))
+			}
+		}
+
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("invalid_school")
+		}
 		if err != nil {
-			return c.JSON(http.StatusNotFound, checkErr(err, "invalid_school"))
+			return apierr.Internal("getting school", err)
 		}
 
 		facultyAdviser.Name = adviserFName + " " + adviserLName
@@ -276,9 +411,18 @@ func ConfigureSchools(e *echo.Echo) {
 
 		school.IsVerified = isVerifiedInt == 1
 
+		if logoId.Valid {
+			school.Logo = attachmentURL(int(logoId.Int64))
+		}
+
 		school.ClubHead = clubHead
 		school.FacultyAdviser = facultyAdviser
 
+		school.Officers, err = getOfficers(school.Id)
+		if err != nil {
+			return apierr.Internal("getting officers", err)
+		}
+
 		userID := c.Get("session").(authentication.SessionInfo).UserID
 
 		if school.IsVerified {
@@ -286,16 +430,22 @@ func ConfigureSchools(e *echo.Echo) {
 		}
 
 		if userID == -1 || (userID != school.ClubHead.Id && userID != school.FacultyAdviser.Id) {
-			return c.JSON(http.StatusUnauthorized, ErrorResponse{"error", "school_unverified"})
+			return apierr.Forbidden("school_unverified")
 		}
 
 		return c.JSON(http.StatusOK, SchoolResponse{"ok", school})
 	})
 
 	e.GET("/schools/search", func(c echo.Context) error {
-		q := c.FormValue("q")
+		request := searchRequest{}
+		err := bind(c, &request)
+		if err != nil {
+			return err
+		}
+
+		q := request.Q
 		if len(q) <= 2 {
-			return c.JSON(http.StatusBadRequest, ErrorResponse{"error", "search_query_too_short"})
+			return apierr.BadRequest("search_query_too_short")
 		}
 
 		// sanitize the query, see https://githubengineering.com/like-injection/ for details
@@ -304,10 +454,9 @@ func ConfigureSchools(e *echo.Echo) {
 		q = strings.Replace(q, "_", "\\_", -1)
 		q = "%" + q + "%"
 
-		rows, err := db.Query("SELECT s.id, s.displayname, s.name, s.website, s.donationsRaised, s.donationGoal, s.foundedDate, s.city, s.state, s.address, s.driveFolder, s.isVerified, u1.id, u1.fname, u1.showsLastname, u1.lname, u1.gradeLevel, u2.id, u2.fname, u2.lname FROM schools s JOIN users u1 ON s.clubheadId = u1.id JOIN users u2 ON s.facultyadviserId = u2.id WHERE s.name LIKE ? OR s.displayname LIKE ?", q, q)
+		rows, err := db.Query("SELECT s.id, s.displayname, s.name, s.website, "+donationsRaisedSQL+", s.donationGoal, s.foundedDate, s.city, s.state, s.address, s.driveFolder, s.isVerified, s.logoId, u1.id, u1.fname, u1.showsLastname, u1.lname, u1.gradeLevel, u2.id, u2.fname, u2.lname FROM schools s JOIN users u1 ON s.clubheadId = u1.id JOIN users u2 ON s.facultyadviserId = u2.id WHERE s.name LIKE ? OR s.displayname LIKE ?", q, q)
 		if err != nil {
-			errlog.LogError("searching for schools", err)
-			return c.JSON(http.StatusNotFound, checkErr(err, "internal_server_error"))
+			return apierr.Internal("searching for schools", err)
 		}
 
 		defer rows.Close()
@@ -316,6 +465,7 @@ func ConfigureSchools(e *echo.Echo) {
 		for rows.Next() {
 			school := School{}
 			isVerifiedInt := 0
+			logoId := sql.NullInt64{}
 			clubHead := User{}
 			clubHeadFName := ""
 			clubHeadLName := ""
@@ -337,6 +487,7 @@ func ConfigureSchools(e *echo.Echo) {
 				&school.Address,
 				&school.DriveFolder,
 				&isVerifiedInt,
+				&logoId,
 				&clubHead.Id,
 				&clubHeadFName,
 				&clubHeadLNameShown,
@@ -348,8 +499,7 @@ func ConfigureSchools(e *echo.Echo) {
 			)
 
 			if err != nil {
-				errlog.LogError("searching for schools", err)
-				return c.JSON(http.StatusNotFound, checkErr(err, "internal_server_error"))
+				return apierr.Internal("scanning school search results", err)
 			}
 
 			facultyAdviser.Name = adviserFName + " " + adviserLName
@@ -365,16 +515,50 @@ func ConfigureSchools(e *echo.Echo) {
 				continue
 			}
 
+			if logoId.Valid {
+				school.Logo = attachmentURL(int(logoId.Int64))
+			}
+
 			school.ClubHead = clubHead
 			school.FacultyAdviser = facultyAdviser
 
 			schools = append(schools, school)
 		}
 
+		rows.Close()
+
+		for i := range schools {
+			schools[i].Officers, err = getOfficers(schools[i].Id)
+			if err != nil {
+				return apierr.Internal("getting officers", err)
+			}
+		}
+
 		return c.JSON(http.StatusOK, SchoolsResponse{"ok", schools})
 	})
 }
 
+// publishMemberJoined tells anyone watching the school's stream about a new member, formatted like /:schoolId/getMembers.
+func publishMemberJoined(userId int, schoolId int) {
+	user := User{Id: userId}
+	var showsLName int
+	var fname, lname string
+
+	err := db.QueryRow("SELECT fname, lname, showsLastname, gradeLevel FROM users WHERE id = ?", userId).Scan(&fname, &lname, &showsLName, &user.GradeLevel)
+	if err != nil {
+		logging.Log.Error("getting new member", err)
+		return
+	}
+
+	if showsLName == 1 {
+		user.Name = fname + " " + lname
+	} else {
+		user.Name = fname
+	}
+
+	publish(schoolId, StreamMemberJoined, user)
+}
+
 func isLetter(s string) bool {
 	for _, r := range s {
 		if !unicode.IsLetter(r) {
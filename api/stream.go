@@ -0,0 +1,164 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
+	"github.com/whiskeybrav/studentclubportal-server/pubsub"
+)
+
+const heartbeatInterval = 25 * time.Second
+
+// These are the event types sent over /:schoolId/stream.
+const (
+	StreamPostCreated     = "post.created"
+	StreamPostDeleted     = "post.deleted"
+	StreamEventCreated    = "event.created"
+	StreamEventDeleted    = "event.deleted"
+	StreamMemberJoined    = "member.joined"
+	StreamMemberRemoved   = "member.removed"
+	StreamClubHeadChanged = "school.clubHeadChanged"
+
+	// StreamReset is sent instead of the missed events when they can't all be caught up on, so the client should fetch
+	// the school's posts and events again
+	StreamReset = pubsub.TypeReset
+)
+
+type DeletedItem struct {
+	ID int `json:"id"`
+}
+
+type ClubHeadChange struct {
+	ClubHeadID int `json:"club_head_id"`
+}
+
+// canViewSchool applies the same rules as /schools/get/:name: verified schools are public, and unverified ones can only
+// be seen by their club head and faculty adviser.
+func canViewSchool(schoolId int, userId int) (bool, error) {
+	isVerifiedInt := 0
+	clubHeadId := 0
+	facultyAdviserId := 0
+
+	err := db.QueryRow("SELECT isVerified, clubheadId, facultyadviserId FROM schools WHERE id = ?", schoolId).Scan(&isVerifiedInt, &clubHeadId, &facultyAdviserId)
+	if err != nil {
+		return false, err
+	}
+
+	if isVerifiedInt == 1 {
+		return true, nil
+	}
+
+	return userId != -1 && (userId == clubHeadId || userId == facultyAdviserId), nil
+}
+
+// publish sends a live update to everyone watching a school's stream.
+func publish(schoolId int, messageType string, data interface{}) {
+	pubsub.Schools.Publish(schoolId, messageType, data)
+}
+
+func writeStreamMessage(c echo.Context, m pubsub.Message) error {
+	data, err := json.Marshal(m.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(c.Response(), "id: %d\nevent: %s\ndata: %s\n\n", m.ID, m.Type, data)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Flush()
+	return nil
+}
+
+func ConfigureStream(e *router) {
+	e.GET("/:schoolId/stream", func(c echo.Context) error {
+		schoolId, err := strconv.Atoi(c.Param("schoolId"))
+		if err != nil {
+			return apierr.BadRequest("invalid_params")
+		}
+
+		session := authentication.GetSession(c)
+
+		allowed, err := canViewSchool(schoolId, session.UserID)
+		if err == sql.ErrNoRows {
+			return apierr.NotFound("invalid_school")
+		}
+		if err != nil {
+			return apierr.Internal("checking school visibility", err)
+		}
+		if !allowed {
+			return apierr.Forbidden("school_unverified")
+		}
+
+		// browsers send Last-Event-ID when they reconnect on their own, but can't set headers on the first connection
+		lastEventId := c.Request().Header.Get("Last-Event-ID")
+		if lastEventId == "" {
+			lastEventId = c.QueryParam("lastEventId")
+		}
+
+		var lastId uint64
+		if lastEventId != "" {
+			lastId, err = strconv.ParseUint(lastEventId, 10, 64)
+			if err != nil {
+				return apierr.BadRequest("invalid_params")
+			}
+		}
+
+		messages, backlog, cancel := pubsub.Schools.Subscribe(schoolId, lastId)
+		defer cancel()
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+		res.Header().Set("Connection", "keep-alive")
+		res.Header().Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+
+		_, err = fmt.Fprintf(res, "retry: %d\n\n", (5 * time.Second).Milliseconds())
+		if err != nil {
+			return nil
+		}
+		res.Flush()
+
+		for _, m := range backlog {
+			err = writeStreamMessage(c, m)
+			if err != nil {
+				return nil
+			}
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case m, ok := <-messages:
+				if !ok {
+					// we fell behind, the client will reconnect and catch up from the history
+					return nil
+				}
+				err = writeStreamMessage(c, m)
+				if err != nil {
+					// the client went away
+					return nil
+				}
+			case <-heartbeat.C:
+				_, err = fmt.Fprint(res, ": heartbeat\n\n")
+				if err != nil {
+					return nil
+				}
+				res.Flush()
+			}
+		}
+	})
+}
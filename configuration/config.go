@@ -1,22 +1,49 @@
 package configuration
 
-import "github.com/BurntSushi/toml"
+import (
+	"os"
+
+	"github.com/BurntSushi/toml"
+)
 
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	Mail     MailConfig
+	Database  DatabaseConfig
+	Server    ServerConfig
+	Mail      MailConfig
+	Storage   StorageConfig
+	Digest    DigestConfig
+	Log       LogConfig
+	Metrics   MetricsConfig
+	Health    HealthConfig
+	RateLimit RateLimitConfig
+	Session   SessionConfig
 }
 
 type DatabaseConfig struct {
 	Username string
 	Password string
 	Database string
+
+	Host   string
+	Port   int
+	Socket string
+
+	MaxOpenConns           int
+	MaxIdleConns           int
+	ConnMaxLifetimeSeconds int
+
+	TLS   string
+	TLSCA string
 }
 
 type ServerConfig struct {
-	Address string
-	CORS    string
+	Address     string
+	CORS        string
+	PublicURL   string
+	FrontendURL string
+
+	ShutdownTimeoutSeconds int
+	DrainSeconds           int
 }
 
 type MailConfig struct {
@@ -29,13 +56,139 @@ type MailConfig struct {
 	SMTPPassword string
 	AdminName    string
 	AdminEmail   string
+
+	UnsubscribeSecret string
+}
+
+type StorageConfig struct {
+	Backend       string
+	Path          string
+	MaxUploadSize int64
+}
+
+type DigestConfig struct {
+	Frequency string
+}
+
+type LogConfig struct {
+	Level  string
+	Format string
+}
+
+type MetricsConfig struct {
+	Address string
+}
+
+type HealthConfig struct {
+	TimeoutSeconds  float64
+	CheckSMTP       bool
+	CheckMigrations bool
+}
+
+type RateLimitConfig struct {
+	Enabled bool
+	Store   string
+
+	// TrustProxyHeaders uses X-Forwarded-For and X-Real-IP for the client's IP. Only turn it on behind a proxy that
+	// sets them, or clients can pick their own IP.
+	TrustProxyHeaders bool
+
+	Policies []RateLimitPolicy `toml:"policy"`
+}
+
+// RateLimitPolicy limits how often a client can call a group of routes, which share one bucket per client.
+type RateLimitPolicy struct {
+	Name string
+
+	// Routes are the method and path of each route, like "POST /v1/auth/login". Limiting a route also limits its
+	// legacy path.
+	Routes []string
+
+	// Key is what a client is counted by: ip, or user to count logged in users by their id and anyone else by IP.
+	Key string
+
+	// Requests can be made every PerSeconds, up to Burst at once. Burst defaults to Requests.
+	Requests   int
+	PerSeconds int
+	Burst      int
 }
 
-func Configure() Config {
-	config := Config{}
-	_, err := toml.DecodeFile("config.toml", &config)
-	if err != nil {
-		panic(err)
+type SessionConfig struct {
+	// SameSite and Secure are set on the session cookie. SameSite is lax, strict or none, which needs Secure.
+	SameSite string
+	Secure   bool
+
+	// CSRFSecret signs CSRF tokens. It has to be the same on every server. If it's empty, a random one is used, so
+	// tokens stop working when the server restarts.
+	CSRFSecret string
+}
+
+// Defaults returns the config used for anything not set in the file or the environment.
+func Defaults() Config {
+	return Config{
+		Database: DatabaseConfig{
+			Host: "127.0.0.1",
+			Port: 3306,
+			TLS:  "false",
+		},
+		Server: ServerConfig{
+			Address:                ":8080",
+			ShutdownTimeoutSeconds: 30,
+		},
+		Mail: MailConfig{
+			SMTPPort: 25,
+		},
+		Storage: StorageConfig{
+			Backend:       "local",
+			Path:          "./uploads",
+			MaxUploadSize: 10 << 20,
+		},
+		Digest: DigestConfig{
+			Frequency: "weekly",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Health: HealthConfig{
+			TimeoutSeconds:  2,
+			CheckMigrations: true,
+		},
+		Session: SessionConfig{
+			SameSite: "lax",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Store:   "memory",
+			Policies: []RateLimitPolicy{
+				{Name: "search", Routes: []string{"GET /v1/schools"}, Key: "ip", Requests: 30, PerSeconds: 60, Burst: 10},
+				{Name: "login", Routes: []string{"POST /v1/auth/login"}, Key: "ip", Requests: 10, PerSeconds: 60},
+				{Name: "password_reset", Routes: []string{"POST /v1/auth/password-reset"}, Key: "ip", Requests: 5, PerSeconds: 3600},
+				{Name: "registration", Routes: []string{"POST /v1/auth/register/teacher", "POST /v1/auth/register/student", "POST /v1/schools"}, Key: "ip", Requests: 10, PerSeconds: 3600, Burst: 5},
+			},
+		},
+	}
+}
+
+// Load reads the config file at path, then applies environment variable overrides and validates the result. When
+// required is false, a missing file is fine and the config comes from defaults and the environment alone. checks
+// validate the parts of the config that other packages know about, and their problems are reported with the rest.
+func Load(path string, required bool, checks ...func(Config) ValidationErrors) (Config, error) {
+	config := Defaults()
+
+	_, err := toml.DecodeFile(path, &config)
+	if err != nil && (required || !os.IsNotExist(err)) {
+		return config, err
 	}
-	return config
+
+	errs := applyEnvironment(&config, os.LookupEnv)
+	errs = append(errs, config.Validate()...)
+	for _, check := range checks {
+		errs = append(errs, check(config)...)
+	}
+	if len(errs) > 0 {
+		return config, errs
+	}
+
+	return config, nil
 }
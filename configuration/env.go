@@ -0,0 +1,111 @@
+package configuration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// envPrefix starts every environment variable that overrides the config, as in SCP_DATABASE_PASSWORD.
+const envPrefix = "SCP_"
+
+// EnvName returns the environment variable for a field, such as SCP_MAIL_SMTP_PASSWORD for Mail.SMTPPassword.
+func EnvName(section string, field string) string {
+	return envPrefix + screamingSnake(section) + "_" + screamingSnake(field)
+}
+
+// screamingSnake turns a Go name into an environment variable name, keeping acronyms together: SMTPPassword becomes
+// SMTP_PASSWORD.
+func screamingSnake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextIsLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+
+	return b.String()
+}
+
+// applyEnvironment overrides every config field that has an environment variable set. NAME_FILE can be set instead of
+// NAME to read the value from a file, which is how most secret stores hand them over.
+func applyEnvironment(config *Config, lookup func(string) (string, bool)) ValidationErrors {
+	var errs ValidationErrors
+
+	sections := reflect.ValueOf(config).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Type().Field(i)
+		fields := sections.Field(i)
+
+		for j := 0; j < fields.NumField(); j++ {
+			field := fields.Type().Field(j)
+			name := EnvName(section.Name, field.Name)
+
+			value, ok := lookup(name)
+			if path, fileOk := lookup(name + "_FILE"); fileOk {
+				if ok {
+					errs = append(errs, fmt.Sprintf("%s: can't set both %s and %s_FILE", name, name, name))
+					continue
+				}
+
+				contents, err := ioutil.ReadFile(path)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s_FILE: %s", name, err))
+					continue
+				}
+
+				value = strings.TrimRight(string(contents), "\r\n")
+				ok = true
+			}
+
+			if !ok {
+				continue
+			}
+
+			err := setField(fields.Field(j), value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+			}
+		}
+	}
+
+	return errs
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("can't be set from the environment")
+	}
+	return nil
+}
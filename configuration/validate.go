@@ -0,0 +1,105 @@
+package configuration
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ValidationErrors lists everything wrong with a config, so it can all be fixed at once.
+type ValidationErrors []string
+
+func (e ValidationErrors) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isAddress(s string) bool {
+	_, _, err := net.SplitHostPort(s)
+	return err == nil
+}
+
+func isRoute(s string) bool {
+	parts := strings.SplitN(s, " ", 2)
+	return len(parts) == 2 && parts[0] != "" && strings.ToUpper(parts[0]) == parts[0] && strings.HasPrefix(parts[1], "/")
+}
+
+// Validate checks every field and returns all the problems it finds.
+func (c Config) Validate() ValidationErrors {
+	var errs ValidationErrors
+	check := func(ok bool, field string, problem string) {
+		if !ok {
+			errs = append(errs, field+": "+problem)
+		}
+	}
+
+	check(c.Database.Username != "", "database.username", "is required")
+	check(c.Database.Database != "", "database.database", "is required")
+	check(c.Database.Port > 0 && c.Database.Port <= 65535, "database.port", "must be between 1 and 65535")
+	check(c.Database.MaxOpenConns >= 0, "database.maxOpenConns", "can't be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.maxIdleConns", "can't be negative")
+	check(c.Database.ConnMaxLifetimeSeconds >= 0, "database.connMaxLifetimeSeconds", "can't be negative")
+	check(oneOf(c.Database.TLS, "", "false", "true", "skip-verify", "preferred", "custom"), "database.tls", "must be false, true, skip-verify, preferred or custom")
+	check(c.Database.TLS != "custom" || c.Database.TLSCA != "", "database.tlsCA", "is required when tls is custom")
+
+	check(isAddress(c.Server.Address), "server.address", "must be a host:port address")
+	check(c.Server.CORS != "", "server.cors", "is required")
+	check(isURL(c.Server.PublicURL), "server.publicUrl", "must be an http or https URL")
+	check(isURL(c.Server.FrontendURL), "server.frontendUrl", "must be an http or https URL")
+	check(c.Server.ShutdownTimeoutSeconds >= 0, "server.shutdownTimeoutSeconds", "can't be negative")
+	check(c.Server.DrainSeconds >= 0, "server.drainSeconds", "can't be negative")
+
+	check(c.Mail.FromAddress != "", "mail.FromAddress", "is required")
+	check(c.Mail.SMTPHost != "", "mail.SMTPHost", "is required")
+	check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort <= 65535, "mail.SMTPPort", "must be between 1 and 65535")
+	check(c.Mail.UnsubscribeSecret != "", "mail.UnsubscribeSecret", "is required")
+
+	check(c.Storage.Backend == "local", "storage.backend", "must be local")
+	check(c.Storage.Path != "", "storage.path", "is required")
+	check(c.Storage.MaxUploadSize >= 0, "storage.maxUploadSize", "can't be negative")
+
+	check(oneOf(c.Digest.Frequency, "", "daily", "weekly", "off"), "digest.frequency", "must be daily, weekly or off")
+
+	check(oneOf(strings.ToLower(c.Log.Level), "", "debug", "info", "warn", "error"), "log.level", "must be debug, info, warn or error")
+	check(oneOf(c.Log.Format, "", "json", "logfmt"), "log.format", "must be json or logfmt")
+
+	check(c.Metrics.Address == "" || isAddress(c.Metrics.Address), "metrics.address", "must be a host:port address")
+
+	check(c.Health.TimeoutSeconds >= 0, "health.timeoutSeconds", "can't be negative")
+
+	check(oneOf(c.RateLimit.Store, "", "memory"), "rateLimit.store", "must be memory")
+	names := map[string]bool{}
+	for i, policy := range c.RateLimit.Policies {
+		field := fmt.Sprintf("rateLimit.policy[%d]", i)
+		check(policy.Name != "", field+".name", "is required")
+		check(!names[policy.Name], field+".name", "is used by another policy")
+		names[policy.Name] = true
+		check(len(policy.Routes) > 0, field+".routes", "is required")
+		for _, route := range policy.Routes {
+			check(isRoute(route), field+".routes", fmt.Sprintf("%q must be a method and path, like \"POST /v1/auth/login\"", route))
+		}
+		check(oneOf(policy.Key, "ip", "user"), field+".key", "must be ip or user")
+		check(policy.Requests > 0, field+".requests", "must be at least 1")
+		check(policy.PerSeconds > 0, field+".perSeconds", "must be at least 1")
+		check(policy.Burst >= 0, field+".burst", "can't be negative")
+	}
+
+	check(oneOf(c.Session.SameSite, "", "lax", "strict", "none"), "session.sameSite", "must be lax, strict or none")
+	check(c.Session.SameSite != "none" || c.Session.Secure, "session.secure", "must be true when sameSite is none")
+
+	return errs
+}
@@ -1,18 +1,100 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
-	_ "github.com/go-sql-driver/mysql"
+	"errors"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
 )
 
 var db *sql.DB
 
+// databaseDSN builds the connection string from the config. With neither a host nor a socket, it connects to MySQL's
+// default local address like before.
+func databaseDSN() (string, error) {
+	dsn := mysql.NewConfig()
+	dsn.User = config.Database.Username
+	dsn.Passwd = config.Database.Password
+	dsn.DBName = config.Database.Database
+	dsn.Collation = "utf8mb4_unicode_ci"
+	dsn.Params = map[string]string{"charset": "utf8mb4"}
+
+	if config.Database.Socket != "" {
+		dsn.Net = "unix"
+		dsn.Addr = config.Database.Socket
+	} else {
+		host := config.Database.Host
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		port := config.Database.Port
+		if port == 0 {
+			port = 3306
+		}
+		dsn.Net = "tcp"
+		dsn.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	switch config.Database.TLS {
+	case "", "false":
+	case "true", "skip-verify", "preferred":
+		dsn.TLSConfig = config.Database.TLS
+	case "custom":
+		// verify the server against our own CA, for managed databases with a private one
+		pem, err := ioutil.ReadFile(config.Database.TLSCA)
+		if err != nil {
+			return "", err
+		}
+
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return "", errors.New("database.TLSCA contains no certificates")
+		}
+
+		err = mysql.RegisterTLSConfig("custom", &tls.Config{
+			RootCAs:    roots,
+			ServerName: config.Database.Host,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		dsn.TLSConfig = "custom"
+	default:
+		return "", errors.New("database.TLS must be false, true, skip-verify, preferred or custom")
+	}
+
+	return dsn.FormatDSN(), nil
+}
+
 func initializeDatabase() {
-	var err error
-	db, err = sql.Open("mysql", config.Database.Username+":"+config.Database.Password+"@/"+config.Database.Database+"?charset=utf8mb4&collation=utf8mb4_unicode_ci")
+	dsn, err := databaseDSN()
 	if err != nil {
 		panic(err)
 	}
+
+	db, err = sql.Open("mysql", dsn)
+	if err != nil {
+		panic(err)
+	}
+
+	if config.Database.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(config.Database.MaxOpenConns)
+	}
+	if config.Database.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.Database.MaxIdleConns)
+	}
+	if config.Database.ConnMaxLifetimeSeconds > 0 {
+		db.SetConnMaxLifetime(time.Duration(config.Database.ConnMaxLifetimeSeconds) * time.Second)
+	}
+
 	err = db.Ping()
 	if err != nil {
 		panic(err)
@@ -22,6 +104,6 @@ func initializeDatabase() {
 func deinitializeDatabase() {
 	err := db.Close()
 	if err != nil {
-		panic(err)
+		logging.Log.Error("closing database", err)
 	}
 }
@@ -0,0 +1,216 @@
+package digest
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/NoteToScreen/maily-go/maily"
+	"github.com/whiskeybrav/studentclubportal-server/configuration"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+	"github.com/whiskeybrav/studentclubportal-server/mail"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
+)
+
+const (
+	FrequencyOff    = "off"
+	FrequencyDaily  = "daily"
+	FrequencyWeekly = "weekly"
+)
+
+// checkInterval is how often the job looks for users whose digest is due.
+const checkInterval = time.Hour
+
+type Post struct {
+	Title string
+	Date  string
+	Text  string
+}
+
+type Event struct {
+	Title      string
+	Attendance string
+	Start      string
+	End        string
+}
+
+type recipient struct {
+	id         int
+	fname      string
+	lname      string
+	email      string
+	schoolId   int
+	schoolName string
+	lastDigest sql.NullString
+}
+
+var config *configuration.Config
+var db *sql.DB
+
+func Configure(configuration *configuration.Config, database *sql.DB) {
+	config = configuration
+	db = database
+}
+
+// interval returns the MySQL interval between two digests, or an empty string if digests are turned off.
+func interval() string {
+	switch config.Digest.Frequency {
+	case FrequencyDaily:
+		return "1 DAY"
+	case "", FrequencyWeekly:
+		return "1 WEEK"
+	default:
+		return ""
+	}
+}
+
+var (
+	stop    chan struct{}
+	stopped chan struct{}
+)
+
+// Start runs the digest job in the background until Stop is called.
+func Start() {
+	if interval() == "" {
+		return
+	}
+
+	stop = make(chan struct{})
+	stopped = make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			SendDue()
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the digest job, waiting for any digests being sent to finish.
+func Stop() {
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-stopped
+}
+
+// SendDue sends a digest to every subscribed user who hasn't received one within the configured interval. Only active
+// members get one, since it has their school's posts in it.
+func SendDue() {
+	i := interval()
+	if i == "" {
+		return
+	}
+
+	rows, err := db.Query("SELECT u.id, u.fname, u.lname, u.email, u.schoolId, s.name, u.lastDigest FROM users u INNER JOIN schools s ON u.schoolId = s.id INNER JOIN memberships m ON m.userId = u.id AND m.schoolId = u.schoolId AND m.status = 'active' LEFT OUTER JOIN notificationPreferences np ON np.userId = u.id WHERE COALESCE(np.digest, 1) = 1 AND (u.lastDigest IS NULL OR u.lastDigest <= DATE_SUB(NOW(), INTERVAL " + i + "))")
+	if err != nil {
+		logging.Log.Error("getting digest recipients", err)
+		return
+	}
+
+	var recipients []recipient
+
+	for rows.Next() {
+		r := recipient{}
+		err := rows.Scan(&r.id, &r.fname, &r.lname, &r.email, &r.schoolId, &r.schoolName, &r.lastDigest)
+		if err != nil {
+			logging.Log.Error("scanning digest recipient", err)
+			rows.Close()
+			return
+		}
+		recipients = append(recipients, r)
+	}
+	rows.Close()
+
+	for _, r := range recipients {
+		err := send(r, i)
+		if err != nil {
+			logging.Log.Error("sending digest", err)
+		}
+	}
+}
+
+func send(r recipient, i string) error {
+	since := r.lastDigest
+
+	posts, err := getPosts(r.schoolId, since, i)
+	if err != nil {
+		return err
+	}
+
+	events, err := getEvents(r.schoolId)
+	if err != nil {
+		return err
+	}
+
+	if len(posts) > 0 || len(events) > 0 {
+		err = mail.SendNotification(r.id, notifications.CategoryDigest, r.fname+" "+r.lname, r.email, "digest", maily.TemplateData{
+			"fname":      r.fname,
+			"schoolName": r.schoolName,
+			"posts":      posts,
+			"events":     events,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the digest is marked as sent even if there was nothing to say, so that the next one only covers new posts
+	_, err = db.Exec("UPDATE users SET lastDigest = NOW() WHERE id = ?", r.id)
+	return err
+}
+
+func getPosts(schoolId int, since sql.NullString, i string) ([]Post, error) {
+	rows, err := db.Query("SELECT title, date, text FROM posts WHERE schoolId = ? AND date > COALESCE(?, DATE_SUB(NOW(), INTERVAL "+i+")) ORDER BY date DESC", schoolId, since)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var posts []Post
+
+	for rows.Next() {
+		post := Post{}
+		err := rows.Scan(&post.Title, &post.Date, &post.Text)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+func getEvents(schoolId int) ([]Event, error) {
+	rows, err := db.Query("SELECT title, attendance, start, end FROM events WHERE schoolId = ? AND end > NOW() AND start < DATE_ADD(NOW(), INTERVAL 2 WEEK) ORDER BY start", schoolId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var events []Event
+
+	for rows.Next() {
+		event := Event{}
+		err := rows.Scan(&event.Title, &event.Attendance, &event.Start, &event.End)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
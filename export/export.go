@@ -0,0 +1,61 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// Writer writes a table one row at a time, so large exports never have to be held in memory.
+type Writer interface {
+	WriteRow(cells []string) error
+	Close() error
+}
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+var ContentTypes = map[string]string{
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// NewWriter returns a writer for the given format, or nil if the format isn't supported.
+func NewWriter(format string, w io.Writer) Writer {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{csv.NewWriter(w)}
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	}
+	return nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// WriteRow writes the cells, quoting any that a spreadsheet would otherwise run as a formula.
+func (c *csvWriter) WriteRow(cells []string) error {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = escapeFormula(cell)
+	}
+	return c.w.Write(escaped)
+}
+
+// escapeFormula prefixes a cell that starts like a formula with a quote, so that opening an export in a spreadsheet
+// shows what a member typed instead of running it.
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	// UserIDKey is where the session middleware leaves the id of the logged in user, or -1.
+	UserIDKey = "logging.userId"
+
+	startKey = "logging.start"
+)
+
+// FromContext returns a logger that adds the request id, user, route and time taken so far to every line.
+func FromContext(c echo.Context) *Logger {
+	fields := Fields{
+		"method": c.Request().Method,
+		"route":  c.Path(),
+	}
+
+	requestId := c.Response().Header().Get(echo.HeaderXRequestID)
+	if requestId == "" {
+		requestId = c.Request().Header.Get(echo.HeaderXRequestID)
+	}
+	if requestId != "" {
+		fields["request_id"] = requestId
+	}
+
+	if userId, ok := c.Get(UserIDKey).(int); ok {
+		fields["user_id"] = userId
+	}
+
+	logger := Log.With(fields)
+	if start, ok := c.Get(startKey).(time.Time); ok {
+		logger.start = start
+	}
+	return logger
+}
+
+// Middleware writes an access log line for every request. It should come after middleware.RequestID so the line
+// includes the request id.
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Set(startKey, time.Now())
+
+		err := next(c)
+		if err != nil {
+			// let echo write the error response now, so the status logged is the one the client gets
+			c.Error(err)
+		}
+
+		fields := Fields{
+			"status": c.Response().Status,
+			"path":   c.Request().URL.Path,
+			"ip":     c.RealIP(),
+			"bytes":  c.Response().Size,
+		}
+
+		logger := FromContext(c)
+		if c.Response().Status >= 500 {
+			logger.Warn("request", fields)
+		} else {
+			logger.Info("request", fields)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,204 @@
+// Package logging writes structured, leveled log lines as JSON or logfmt.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/whiskeybrav/studentclubportal-server/configuration"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel turns a level name from the config into a Level.
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("logging: unknown level %q", name)
+}
+
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// Fields are extra key/value pairs added to a log line.
+type Fields map[string]interface{}
+
+var (
+	mu       sync.Mutex
+	out      io.Writer = os.Stdout
+	minLevel           = LevelInfo
+	format             = FormatJSON
+)
+
+// Log is the logger for code that isn't handling a request. Handlers should use FromContext instead.
+var Log = &Logger{}
+
+type Logger struct {
+	fields Fields
+	start  time.Time
+}
+
+func Configure(config configuration.Config) {
+	// configuration.Validate has already checked the level and format, and empty ones mean the defaults
+	level, _ := ParseLevel(config.Log.Level)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	minLevel = level
+
+	format = FormatJSON
+	if config.Log.Format == FormatLogfmt {
+		format = FormatLogfmt
+	}
+}
+
+// With returns a logger that adds the given fields to every line.
+func (l *Logger) With(fields Fields) *Logger {
+	merged := Fields{}
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{fields: merged, start: l.start}
+}
+
+func (l *Logger) Debug(msg string, fields ...Fields) {
+	l.log(LevelDebug, msg, fields)
+}
+
+func (l *Logger) Info(msg string, fields ...Fields) {
+	l.log(LevelInfo, msg, fields)
+}
+
+func (l *Logger) Warn(msg string, fields ...Fields) {
+	l.log(LevelWarn, msg, fields)
+}
+
+// Error logs something that went wrong. The stack is only included when logging at debug level, since it's long.
+func (l *Logger) Error(msg string, err error, fields ...Fields) {
+	extra := Fields{}
+	if err != nil {
+		extra["error"] = err.Error()
+	}
+	if Enabled(LevelDebug) {
+		extra["stack"] = string(debug.Stack())
+	}
+	l.log(LevelError, msg, append(fields, extra))
+}
+
+// Enabled reports whether lines at the given level are written.
+func Enabled(level Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return level >= minLevel
+}
+
+func (l *Logger) log(level Level, msg string, extra []Fields) {
+	if !Enabled(level) {
+		return
+	}
+
+	now := time.Now()
+
+	fields := Fields{}
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for _, f := range extra {
+		for k, v := range f {
+			fields[k] = v
+		}
+	}
+	if !l.start.IsZero() {
+		fields["latency_ms"] = float64(now.Sub(l.start).Microseconds()) / 1000
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var line bytes.Buffer
+
+	if format == FormatLogfmt {
+		writeLogfmt(&line, "time", now.UTC().Format(time.RFC3339Nano))
+		writeLogfmt(&line, "level", level.String())
+		writeLogfmt(&line, "msg", msg)
+		for _, k := range keys {
+			writeLogfmt(&line, k, fields[k])
+		}
+	} else {
+		line.WriteString(`{"time":`)
+		writeJSON(&line, now.UTC().Format(time.RFC3339Nano))
+		line.WriteString(`,"level":`)
+		writeJSON(&line, level.String())
+		line.WriteString(`,"msg":`)
+		writeJSON(&line, msg)
+		for _, k := range keys {
+			line.WriteByte(',')
+			writeJSON(&line, k)
+			line.WriteByte(':')
+			writeJSON(&line, fields[k])
+		}
+		line.WriteByte('}')
+	}
+
+	line.WriteByte('\n')
+	out.Write(line.Bytes())
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(encoded)
+}
+
+func writeLogfmt(buf *bytes.Buffer, key string, v interface{}) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " =\"\n\t") {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
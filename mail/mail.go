@@ -3,11 +3,15 @@ package mail
 import (
 	"github.com/NoteToScreen/maily-go/maily"
 	"github.com/whiskeybrav/studentclubportal-server/configuration"
+	"github.com/whiskeybrav/studentclubportal-server/metrics"
 )
 
 var Mail maily.Context
+var config configuration.Config
+
+func ConfigureMail(configuration configuration.Config) {
+	config = configuration
 
-func ConfigureMail(config configuration.Config) {
 	Mail = maily.Context{
 		FromAddress:  config.Mail.FromAddress,
 		FromDisplay:  config.Mail.FromDisplay,
@@ -19,3 +23,10 @@ func ConfigureMail(config configuration.Config) {
 		TemplatePath: "./mail/templates",
 	}
 }
+
+// Send sends a transactional email through maily, recording whether it worked.
+func Send(toName string, toEmail string, templateName string, data maily.TemplateData) error {
+	_, err := Mail.SendMail(toName, toEmail, templateName, data, maily.FuncMap{}, maily.FuncMap{})
+	metrics.MailSent(templateName, err)
+	return err
+}
@@ -0,0 +1,150 @@
+package mail
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/NoteToScreen/maily-go/maily"
+	"github.com/whiskeybrav/studentclubportal-server/metrics"
+	"github.com/whiskeybrav/studentclubportal-server/util"
+)
+
+type templateContext struct {
+	Data maily.TemplateData
+}
+
+// SendNotification sends a non-transactional email. It adds a signed unsubscribe link for the given category to the
+// template data as unsubscribeURL, and sets the List-Unsubscribe and List-Unsubscribe-Post headers so mail clients can
+// offer one-click unsubscribing (RFC 8058). maily can't set extra headers, so the message is built here from the same
+// templates. Callers are responsible for checking the user's preferences first.
+func SendNotification(userId int, category string, toName string, toEmail string, templateName string, data maily.TemplateData) error {
+	err := sendNotification(userId, category, toName, toEmail, templateName, data)
+	metrics.MailSent(templateName, err)
+	return err
+}
+
+func sendNotification(userId int, category string, toName string, toEmail string, templateName string, data maily.TemplateData) error {
+	unsubscribeURL := UnsubscribeURL(userId, category)
+	data["unsubscribeURL"] = unsubscribeURL
+
+	subject, html, text, err := render(templateName, data)
+	if err != nil {
+		return err
+	}
+
+	message, err := buildNotification(toName, toEmail, subject, html, text, unsubscribeURL)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if Mail.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", Mail.SMTPUsername, Mail.SMTPPassword, Mail.SMTPHost)
+	}
+
+	return smtp.SendMail(Mail.SMTPHost+":"+strconv.Itoa(Mail.SMTPPort), auth, Mail.FromAddress, []string{toEmail}, message)
+}
+
+// buildNotification builds the message, with text and HTML parts and the List-Unsubscribe headers.
+func buildNotification(toName, toEmail, subject, html, text, unsubscribeURL string) ([]byte, error) {
+	messageId, err := util.GenerateRandomString(18)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	header := []string{
+		"From: " + (&netmail.Address{Name: Mail.FromDisplay, Address: Mail.FromAddress}).String(),
+		"To: " + (&netmail.Address{Name: toName, Address: toEmail}).String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + messageId + "@" + Mail.SendDomain + ">",
+		"List-Unsubscribe: <" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + strconv.Quote(parts.Boundary()),
+	}
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write([]byte(part.content))
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = parts.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(strings.Join(header, "\r\n") + "\r\n\r\n" + body.String()), nil
+}
+
+// render fills in a template the same way maily does, with the HTML part wrapped in base.html.
+func render(templateName string, data maily.TemplateData) (string, string, string, error) {
+	ctx := templateContext{data}
+	dir := filepath.Join(Mail.TemplatePath, templateName)
+
+	var subject, html, text bytes.Buffer
+
+	subjectTemplate, err := texttemplate.ParseFiles(filepath.Join(dir, "subject.txt"))
+	if err != nil {
+		return "", "", "", err
+	}
+	err = subjectTemplate.Execute(&subject, ctx)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	htmlTemplate, err := htmltemplate.ParseFiles(filepath.Join(Mail.TemplatePath, "base.html"), filepath.Join(dir, "template.html"))
+	if err != nil {
+		return "", "", "", err
+	}
+	err = htmlTemplate.ExecuteTemplate(&html, "template.html", ctx)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	textTemplate, err := texttemplate.ParseFiles(filepath.Join(dir, "template.txt"))
+	if err != nil {
+		return "", "", "", err
+	}
+	err = textTemplate.Execute(&text, ctx)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return strings.TrimSpace(subject.String()), html.String(), text.String(), nil
+}
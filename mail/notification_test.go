@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"strings"
+	"testing"
+
+	"github.com/NoteToScreen/maily-go/maily"
+)
+
+func TestBuildNotification(t *testing.T) {
+	Mail = maily.Context{FromAddress: "clubs@example.com", FromDisplay: "Student Clubs", SendDomain: "example.com"}
+
+	message, err := buildNotification("Ada Lovelace", "ada@example.com", "Your digest", "<p>Hi</p>", "Hi", "https://example.com/notifications/unsubscribe?token=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := netmail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := []struct {
+		name string
+		want string
+	}{
+		{"From", `"Student Clubs" <clubs@example.com>`},
+		{"To", `"Ada Lovelace" <ada@example.com>`},
+		{"Subject", "Your digest"},
+		{"List-Unsubscribe", "<https://example.com/notifications/unsubscribe?token=abc>"},
+		{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+	}
+	for _, header := range headers {
+		if got := parsed.Header.Get(header.name); got != header.want {
+			t.Errorf("%s is %q, want %q", header.name, got, header.want)
+		}
+	}
+
+	if id := parsed.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID is %q, want one at example.com", id)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type is %q", parsed.Header.Get("Content-Type"))
+	}
+
+	var contentTypes []string
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentTypes = append(contentTypes, part.Header.Get("Content-Type"))
+	}
+
+	if strings.Join(contentTypes, ", ") != "text/plain; charset=utf-8, text/html; charset=utf-8" {
+		t.Errorf("the parts are %v, want text then HTML", contentTypes)
+	}
+}
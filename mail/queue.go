@@ -0,0 +1,62 @@
+package mail
+
+import (
+	"github.com/NoteToScreen/maily-go/maily"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+)
+
+// queueSize is how many emails can wait to be sent before Queue blocks.
+const queueSize = 1000
+
+type queuedMail struct {
+	toName       string
+	toEmail      string
+	templateName string
+	data         maily.TemplateData
+}
+
+var (
+	queue   chan queuedMail
+	stopped chan struct{}
+)
+
+// Start sends queued emails in the background until Stop is called.
+func Start() {
+	queue = make(chan queuedMail, queueSize)
+	stopped = make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		for m := range queue {
+			err := Send(m.toName, m.toEmail, m.templateName, m.data)
+			if err != nil {
+				logging.Log.Error("sending queued "+m.templateName+" email", err)
+			}
+		}
+	}()
+}
+
+// Stop waits for the queued emails to be sent. Nothing can be queued afterwards.
+func Stop() {
+	if queue == nil {
+		return
+	}
+
+	close(queue)
+	<-stopped
+}
+
+// Queue sends a transactional email in the background, for when there are too many to send during a request. Errors
+// are only logged. Without Start, it sends right away.
+func Queue(toName string, toEmail string, templateName string, data maily.TemplateData) {
+	if queue == nil {
+		err := Send(toName, toEmail, templateName, data)
+		if err != nil {
+			logging.Log.Error("sending "+templateName+" email", err)
+		}
+		return
+	}
+
+	queue <- queuedMail{toName, toEmail, templateName, data}
+}
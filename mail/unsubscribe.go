@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidToken = errors.New("mail: invalid unsubscribe token")
+
+func sign(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.Mail.UnsubscribeSecret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// UnsubscribeToken creates a token that lets whoever holds it unsubscribe the user from a single category of email,
+// without logging in.
+func UnsubscribeToken(userId int, category string) string {
+	payload := strconv.Itoa(userId) + ":" + category
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(sign(payload))
+}
+
+// ParseUnsubscribeToken checks the token's signature and returns the user and category it was made for.
+func ParseUnsubscribeToken(token string) (int, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return 0, "", ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, "", ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, sign(string(payload))) {
+		return 0, "", ErrInvalidToken
+	}
+
+	fields := strings.SplitN(string(payload), ":", 2)
+	if len(fields) != 2 {
+		return 0, "", ErrInvalidToken
+	}
+
+	userId, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, "", ErrInvalidToken
+	}
+
+	return userId, fields[1], nil
+}
+
+func UnsubscribeURL(userId int, category string) string {
+	return config.Server.PublicURL + "/notifications/unsubscribe?token=" + url.QueryEscape(UnsubscribeToken(userId, category))
+}
@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/whiskeybrav/studentclubportal-server/configuration"
+)
+
+func TestParseUnsubscribeToken(t *testing.T) {
+	config = configuration.Defaults()
+	config.Mail.UnsubscribeSecret = "secret"
+
+	valid := UnsubscribeToken(42, "digest")
+	payload, signature := splitToken(valid)
+
+	config.Mail.UnsubscribeSecret = "other secret"
+	otherSecret := UnsubscribeToken(42, "digest")
+	config.Mail.UnsubscribeSecret = "secret"
+
+	tests := []struct {
+		name         string
+		token        string
+		wantUserId   int
+		wantCategory string
+		wantErr      bool
+	}{
+		{"valid", valid, 42, "digest", false},
+		{"empty", "", 0, "", true},
+		{"no signature", payload, 0, "", true},
+		{"extra part", valid + ".x", 0, "", true},
+		{"signed with another secret", otherSecret, 0, "", true},
+		{"other user", encode("43:digest") + "." + signature, 0, "", true},
+		{"other category", encode("42:adminNotices") + "." + signature, 0, "", true},
+		{"truncated signature", payload + "." + signature[:len(signature)-2], 0, "", true},
+		{"bad base64", payload + ".!!!", 0, "", true},
+		{"signed without a category", signedWith("42"), 0, "", true},
+		{"signed with a bad user", signedWith("me:digest"), 0, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userId, category, err := ParseUnsubscribeToken(test.token)
+			if test.wantErr {
+				if err != ErrInvalidToken {
+					t.Errorf("ParseUnsubscribeToken returned %d, %q, %v, want ErrInvalidToken", userId, category, err)
+				}
+				return
+			}
+
+			if err != nil || userId != test.wantUserId || category != test.wantCategory {
+				t.Errorf("ParseUnsubscribeToken returned %d, %q, %v, want %d, %q", userId, category, err, test.wantUserId, test.wantCategory)
+			}
+		})
+	}
+}
+
+func splitToken(token string) (string, string) {
+	parts := strings.SplitN(token, ".", 2)
+	return parts[0], parts[1]
+}
+
+func encode(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// signedWith makes a correctly signed token around any payload.
+func signedWith(payload string) string {
+	return encode(payload) + "." + base64.RawURLEncoding.EncodeToString(sign(payload))
+}
@@ -1,44 +1,146 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
 	"github.com/whiskeybrav/studentclubportal-server/api"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
 	"github.com/whiskeybrav/studentclubportal-server/api/authentication"
 	"github.com/whiskeybrav/studentclubportal-server/configuration"
+	"github.com/whiskeybrav/studentclubportal-server/digest"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
 	"github.com/whiskeybrav/studentclubportal-server/mail"
+	"github.com/whiskeybrav/studentclubportal-server/metrics"
+	"github.com/whiskeybrav/studentclubportal-server/notifications"
+	"github.com/whiskeybrav/studentclubportal-server/pubsub"
+	"github.com/whiskeybrav/studentclubportal-server/ratelimit"
+	"github.com/whiskeybrav/studentclubportal-server/storage"
 )
 
+const defaultShutdownTimeout = 30 * time.Second
+
 var config configuration.Config
 
 func main() {
-	config = configuration.Configure()
+	configPath := flag.String("config", "config.toml", "path to the config file")
+	flag.Parse()
+
+	// the default config file is optional, since everything can be set through SCP_ environment variables instead
+	configRequired := false
+	flag.Visit(func(f *flag.Flag) {
+		configRequired = configRequired || f.Name == "config"
+	})
+
+	var err error
+	config, err = configuration.Load(*configPath, configRequired, api.ValidateConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	logging.Configure(config)
 	mail.ConfigureMail(config)
+	storage.ConfigureStorage(config)
+	ratelimit.ConfigureRateLimit(config)
 	initializeDatabase()
-	defer deinitializeDatabase()
 	authentication.Configure(db)
+	notifications.Configure(db)
+	digest.Configure(&config, db)
+	digest.Start()
+	mail.Start()
+	metrics.Configure(config, db)
+	metrics.Start()
 
 	e := echo.New()
 
 	e.HideBanner = true
+	e.HTTPErrorHandler = apierr.Handler
 
 	fmt.Println(logotype)
 
 	e.Pre(middleware.RemoveTrailingSlash())
-	e.Use(authentication.SessionMiddleware)
 	e.Use(middleware.RequestID())
+	e.Use(logging.Middleware)
+	e.Use(metrics.Middleware)
+	// before sessions, so preflight requests don't get one, and errors from the session middleware can be read
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{config.Server.CORS},
-		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, authentication.HeaderCSRFToken},
+		ExposeHeaders:    []string{authentication.HeaderCSRFToken, "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
 		AllowCredentials: true,
 	}))
+	e.Use(authentication.SessionMiddlewareWithConfig(authentication.SessionConfig{
+		Skipper:     api.IsHealthCheck,
+		CSRFSkipper: api.IsCSRFExempt,
+		CSRFSecret:  []byte(config.Session.CSRFSecret),
+		SameSite:    authentication.ParseSameSite(config.Session.SameSite),
+		Secure:      config.Session.Secure,
+	}))
 
 	api.Configure(e, &config, db)
 
-	e.Logger.Fatal(e.Start(config.Server.Address))
+	serverErrors := make(chan error, 1)
+	go func() {
+		serverErrors <- e.Start(config.Server.Address)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErrors:
+		logging.Log.Error("starting server", err)
+		digest.Stop()
+		mail.Stop()
+		deinitializeDatabase()
+		os.Exit(1)
+	case sig := <-signals:
+		logging.Log.Info("shutting down", logging.Fields{"signal": sig.String()})
+		shutdown(e)
+	}
+}
+
+// shutdown stops taking new requests, lets the ones in flight finish, then stops everything else.
+func shutdown(e *echo.Echo) {
+	api.Drain()
+	if config.Server.DrainSeconds > 0 {
+		// give load balancers time to notice /readyz failing before connections are refused
+		time.Sleep(time.Duration(config.Server.DrainSeconds) * time.Second)
+	}
+
+	timeout := defaultShutdownTimeout
+	if config.Server.ShutdownTimeoutSeconds > 0 {
+		timeout = time.Duration(config.Server.ShutdownTimeoutSeconds) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// live streams never finish on their own
+	pubsub.Schools.Close()
+
+	err := e.Shutdown(ctx)
+	if err != nil {
+		logging.Log.Error("shutting down server", err)
+	}
+
+	err = metrics.Stop(ctx)
+	if err != nil {
+		logging.Log.Error("shutting down metrics server", err)
+	}
+
+	digest.Stop()
+	mail.Stop()
+	deinitializeDatabase()
 }
 
 var logotype = strings.Replace(`
@@ -0,0 +1,143 @@
+// Package metrics exposes Prometheus metrics on their own address, so they aren't reachable through the public API.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/whiskeybrav/studentclubportal-server/configuration"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+)
+
+const namespace = "studentclubportal"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	mailSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_sent_total",
+		Help:      "Emails sent, by template and result.",
+	}, []string{"template", "result"})
+
+	registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Accounts registered, by user type.",
+	}, []string{"user_type"})
+)
+
+var server *http.Server
+
+// Configure registers the metrics. The database is used for the connection pool stats and for counting sessions.
+func Configure(config configuration.Config, db *sql.DB) {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "main"),
+		requests,
+		requestDuration,
+		mailSent,
+		registrations,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_sessions",
+			Help:      "Unexpired sessions with a logged in user.",
+		}, func() float64 {
+			count := 0
+			err := db.QueryRow("SELECT COUNT(*) FROM sessions WHERE userId != -1 AND expiry > NOW()").Scan(&count)
+			if err != nil {
+				logging.Log.Error("counting sessions for metrics", err)
+				return 0
+			}
+			return float64(count)
+		}),
+	)
+
+	if config.Metrics.Address != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		server = &http.Server{Addr: config.Metrics.Address, Handler: mux}
+	}
+}
+
+// Start serves /metrics in the background, if a metrics address is configured.
+func Start() {
+	if server == nil {
+		return
+	}
+
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			logging.Log.Error("serving metrics", err)
+		}
+	}()
+}
+
+// Stop stops serving /metrics, waiting up until the context is done for scrapes in progress.
+func Stop(ctx context.Context) error {
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
+// Middleware counts and times requests by the route that handled them, rather than the path, so ids in paths don't
+// create a new series for every school.
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+
+		err := next(c)
+		if err != nil {
+			c.Error(err)
+		}
+
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := strconv.Itoa(c.Response().Status)
+
+		requests.WithLabelValues(route, c.Request().Method, status).Inc()
+		requestDuration.WithLabelValues(route, c.Request().Method, status).Observe(time.Since(start).Seconds())
+
+		return nil
+	}
+}
+
+// MailSent records an attempt to send an email, given the error it returned.
+func MailSent(template string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	mailSent.WithLabelValues(template, result).Inc()
+}
+
+// Registered records a new account. The user type is a name like "teacher" or "student".
+func Registered(userType string) {
+	registrations.WithLabelValues(userType).Inc()
+}
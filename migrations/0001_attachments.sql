@@ -0,0 +1,28 @@
+CREATE TABLE attachments
+(
+    id         INT AUTO_INCREMENT PRIMARY KEY,
+    schoolId   INT          NOT NULL,
+    uploaderId INT          NOT NULL,
+    storageKey VARCHAR(64)  NOT NULL UNIQUE,
+    filename   VARCHAR(255) NOT NULL,
+    mimeType   VARCHAR(100) NOT NULL,
+    size       BIGINT       NOT NULL,
+    created    DATETIME     NOT NULL
+);
+
+CREATE TABLE postAttachments
+(
+    postId       INT NOT NULL,
+    attachmentId INT NOT NULL,
+    PRIMARY KEY (postId, attachmentId)
+);
+
+CREATE TABLE eventAttachments
+(
+    eventId      INT NOT NULL,
+    attachmentId INT NOT NULL,
+    PRIMARY KEY (eventId, attachmentId)
+);
+
+ALTER TABLE schools
+    ADD COLUMN logoId INT NULL DEFAULT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN receivesDigest TINYINT(1)  NOT NULL DEFAULT 1,
+    ADD COLUMN unsubscribeKey VARCHAR(64) NULL DEFAULT NULL UNIQUE,
+    ADD COLUMN lastDigest     DATETIME    NULL DEFAULT NULL;
@@ -0,0 +1,16 @@
+CREATE TABLE notificationPreferences
+(
+    userId         INT PRIMARY KEY,
+    digest         TINYINT(1) NOT NULL DEFAULT 1,
+    eventReminders TINYINT(1) NOT NULL DEFAULT 1,
+    commentReplies TINYINT(1) NOT NULL DEFAULT 1,
+    adminNotices   TINYINT(1) NOT NULL DEFAULT 1
+);
+
+INSERT INTO notificationPreferences (userId, digest)
+SELECT id, receivesDigest
+FROM users
+WHERE receivesDigest = 0;
+
+ALTER TABLE users
+    DROP COLUMN receivesDigest;
@@ -0,0 +1,12 @@
+CREATE TABLE notifications
+(
+    id      INT AUTO_INCREMENT PRIMARY KEY,
+    userId  INT          NOT NULL,
+    type    VARCHAR(32)  NOT NULL,
+    title   VARCHAR(255) NOT NULL,
+    body    TEXT         NOT NULL,
+    link    VARCHAR(255) NOT NULL DEFAULT '',
+    isRead  TINYINT(1)   NOT NULL DEFAULT 0,
+    created DATETIME     NOT NULL,
+    INDEX (userId, isRead)
+);
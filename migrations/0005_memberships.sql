@@ -0,0 +1,17 @@
+CREATE TABLE memberships
+(
+    id        INT AUTO_INCREMENT PRIMARY KEY,
+    userId    INT         NOT NULL,
+    schoolId  INT         NOT NULL,
+    status    VARCHAR(16) NOT NULL,
+    requested DATETIME    NOT NULL,
+    decided   DATETIME    NULL DEFAULT NULL,
+    decidedBy INT         NULL DEFAULT NULL,
+    UNIQUE (userId, schoolId),
+    INDEX (schoolId, status)
+);
+
+-- everyone who was already at a school stays on its roster
+INSERT INTO memberships (userId, schoolId, status, requested, decided)
+SELECT id, schoolId, 'active', registration, NOW()
+FROM users;
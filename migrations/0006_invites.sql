@@ -0,0 +1,16 @@
+CREATE TABLE invites
+(
+    id        INT AUTO_INCREMENT PRIMARY KEY,
+    schoolId  INT         NOT NULL,
+    code      VARCHAR(16) NOT NULL UNIQUE,
+    createdBy INT         NOT NULL,
+    created   DATETIME    NOT NULL,
+    expiry    DATETIME    NULL DEFAULT NULL,
+    maxUses   INT         NULL DEFAULT NULL,
+    uses      INT         NOT NULL DEFAULT 0,
+    role      VARCHAR(32) NOT NULL DEFAULT '',
+    revoked   TINYINT(1)  NOT NULL DEFAULT 0
+);
+
+ALTER TABLE memberships
+    ADD COLUMN inviteId INT NULL DEFAULT NULL;
@@ -0,0 +1,19 @@
+CREATE TABLE schoolRoles
+(
+    id                INT AUTO_INCREMENT PRIMARY KEY,
+    schoolId          INT          NOT NULL,
+    userId            INT          NOT NULL,
+    title             VARCHAR(64)  NOT NULL,
+    canPost           TINYINT(1)   NOT NULL DEFAULT 0,
+    canManageEvents   TINYINT(1)   NOT NULL DEFAULT 0,
+    canManageMembers  TINYINT(1)   NOT NULL DEFAULT 0,
+    canManageFinances TINYINT(1)   NOT NULL DEFAULT 0,
+    created           DATETIME     NOT NULL,
+    UNIQUE (schoolId, userId)
+);
+
+-- club heads become the first officers, with what they could already do
+INSERT INTO schoolRoles (schoolId, userId, title, canPost, canManageEvents, canManageMembers, canManageFinances, created)
+SELECT id, clubheadId, 'Club Head', 1, 1, 1, 0, NOW()
+FROM schools
+WHERE clubheadId != -1;
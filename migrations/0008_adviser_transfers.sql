@@ -0,0 +1,14 @@
+CREATE TABLE adviserTransfers
+(
+    id         INT AUTO_INCREMENT PRIMARY KEY,
+    schoolId   INT         NOT NULL,
+    fromUserId INT         NOT NULL,
+    toUserId   INT         NOT NULL,
+    `key`      VARCHAR(64) NULL DEFAULT NULL UNIQUE,
+    created    DATETIME    NOT NULL,
+    expiry     DATETIME    NULL DEFAULT NULL,
+    accepted   DATETIME    NULL DEFAULT NULL,
+    cancelled  DATETIME    NULL DEFAULT NULL,
+    byAdmin    INT         NULL DEFAULT NULL,
+    INDEX (schoolId)
+);
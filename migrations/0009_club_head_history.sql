@@ -0,0 +1,16 @@
+CREATE TABLE clubHeadHistory
+(
+    id         INT AUTO_INCREMENT PRIMARY KEY,
+    schoolId   INT      NOT NULL,
+    userId     INT      NOT NULL,
+    assignedBy INT      NOT NULL,
+    started    DATETIME NOT NULL,
+    ended      DATETIME NULL DEFAULT NULL,
+    INDEX (schoolId)
+);
+
+-- when current club heads were appointed was never recorded, so their terms start now
+INSERT INTO clubHeadHistory (schoolId, userId, assignedBy, started)
+SELECT id, clubheadId, facultyadviserId, NOW()
+FROM schools
+WHERE clubheadId != -1;
@@ -0,0 +1,18 @@
+CREATE TABLE schoolAliases
+(
+    displayname VARCHAR(255) PRIMARY KEY,
+    schoolId    INT      NOT NULL,
+    created     DATETIME NOT NULL
+);
+
+CREATE TABLE schoolChanges
+(
+    id       INT AUTO_INCREMENT PRIMARY KEY,
+    schoolId INT         NOT NULL,
+    userId   INT         NOT NULL,
+    field    VARCHAR(32) NOT NULL,
+    oldValue TEXT        NOT NULL,
+    newValue TEXT        NOT NULL,
+    changed  DATETIME    NOT NULL,
+    INDEX (schoolId)
+);
@@ -0,0 +1,24 @@
+CREATE TABLE donations
+(
+    id         INT AUTO_INCREMENT PRIMARY KEY,
+    schoolId   INT            NOT NULL,
+    amount     DECIMAL(10, 2) NOT NULL,
+    donorName  VARCHAR(255)   NULL DEFAULT NULL,
+    donated    DATE           NOT NULL,
+    method     VARCHAR(16)    NOT NULL,
+    note       TEXT           NOT NULL,
+    recordedBy INT            NOT NULL,
+    recorded   DATETIME       NOT NULL,
+    voidedBy   INT            NULL DEFAULT NULL,
+    voided     DATETIME       NULL DEFAULT NULL,
+    voidReason TEXT           NULL DEFAULT NULL,
+    INDEX (schoolId)
+);
+
+-- whatever was in donationsRaised before the ledger becomes a single opening entry
+INSERT INTO donations (schoolId, amount, donorName, donated, method, note, recordedBy, recorded)
+SELECT id, donationsRaised, NULL, CURDATE(), 'other', 'Raised before the donation ledger', facultyadviserId, NOW()
+FROM schools
+WHERE donationsRaised > 0;
+
+ALTER TABLE schools DROP COLUMN donationsRaised;
@@ -0,0 +1,15 @@
+CREATE TABLE campaigns
+(
+    id          INT AUTO_INCREMENT PRIMARY KEY,
+    schoolId    INT            NOT NULL,
+    title       VARCHAR(255)   NOT NULL,
+    description TEXT           NOT NULL,
+    start       DATE           NOT NULL,
+    end         DATE           NOT NULL,
+    goal        DECIMAL(10, 2) NOT NULL,
+    createdBy   INT            NOT NULL,
+    created     DATETIME       NOT NULL,
+    INDEX (schoolId)
+);
+
+ALTER TABLE donations ADD COLUMN campaignId INT NULL DEFAULT NULL AFTER schoolId, ADD INDEX (campaignId), ADD INDEX (donated);
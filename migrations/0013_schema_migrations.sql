@@ -0,0 +1,22 @@
+-- Records which migrations have been applied, so /readyz can tell when the database is behind the code. Every
+-- migration from here on should end by inserting its own number.
+CREATE TABLE schemaMigrations
+(
+    version INT PRIMARY KEY,
+    applied DATETIME NOT NULL
+);
+
+INSERT INTO schemaMigrations (version, applied)
+VALUES (1, NOW()),
+       (2, NOW()),
+       (3, NOW()),
+       (4, NOW()),
+       (5, NOW()),
+       (6, NOW()),
+       (7, NOW()),
+       (8, NOW()),
+       (9, NOW()),
+       (10, NOW()),
+       (11, NOW()),
+       (12, NOW()),
+       (13, NOW());
@@ -0,0 +1,16 @@
+-- lets invites hand out any officer role, not just club head
+ALTER TABLE invites
+    ADD COLUMN title             VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN canPost           TINYINT(1)  NOT NULL DEFAULT 0,
+    ADD COLUMN canManageEvents   TINYINT(1)  NOT NULL DEFAULT 0,
+    ADD COLUMN canManageMembers  TINYINT(1)  NOT NULL DEFAULT 0,
+    ADD COLUMN canManageFinances TINYINT(1)  NOT NULL DEFAULT 0;
+
+-- a role is for one person, so invites that hand one out can only be used once
+UPDATE invites
+SET maxUses = GREATEST(uses, 1)
+WHERE role != ''
+  AND (maxUses IS NULL OR maxUses > GREATEST(uses, 1));
+
+INSERT INTO schemaMigrations (version, applied)
+VALUES (14, NOW());
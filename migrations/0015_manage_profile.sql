@@ -0,0 +1,14 @@
+-- editing the school's profile becomes its own permission instead of something every officer can do
+ALTER TABLE schoolRoles
+    ADD COLUMN canManageProfile TINYINT(1) NOT NULL DEFAULT 0;
+
+ALTER TABLE invites
+    ADD COLUMN canManageProfile TINYINT(1) NOT NULL DEFAULT 0;
+
+-- club heads keep what they could already do
+UPDATE schoolRoles
+SET canManageProfile = 1
+WHERE title = 'Club Head';
+
+INSERT INTO schemaMigrations (version, applied)
+VALUES (15, NOW());
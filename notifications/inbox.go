@@ -0,0 +1,89 @@
+package notifications
+
+// These are the kinds of in-app notification, so the frontend can pick an icon or decide where to link.
+const (
+	TypeClubHead       = "clubHead"
+	TypeSchoolVerified = "schoolVerified"
+	TypeNewPost        = "newPost"
+	TypeNewEvent       = "newEvent"
+
+	TypeMembershipApproved = "membershipApproved"
+	TypeRoleAssigned       = "roleAssigned"
+	TypeAdviserChanged     = "adviserChanged"
+)
+
+type Notification struct {
+	ID      int    `json:"id"`
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Link    string `json:"link"`
+	Read    bool   `json:"read"`
+	Created string `json:"created"`
+}
+
+// Notify puts a notification in the inbox of each of the given users.
+func Notify(userIds []int, n Notification) error {
+	for _, userId := range userIds {
+		_, err := db.Exec("INSERT INTO notifications (userId, type, title, body, link, isRead, created) VALUES (?, ?, ?, ?, ?, 0, NOW())", userId, n.Type, n.Title, n.Body, n.Link)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotifySchool puts a notification in the inbox of every active member of a school except exceptUserId, who is
+// usually whoever caused it. Students who are waiting to join, or were turned down or removed, don't get them.
+func NotifySchool(schoolId int, exceptUserId int, n Notification) error {
+	_, err := db.Exec("INSERT INTO notifications (userId, type, title, body, link, isRead, created) SELECT u.id, ?, ?, ?, ?, 0, NOW() FROM users u INNER JOIN memberships m ON m.userId = u.id AND m.schoolId = ? AND m.status = 'active' WHERE u.id != ?", n.Type, n.Title, n.Body, n.Link, schoolId, exceptUserId)
+	return err
+}
+
+// List returns the user's most recent notifications, newest first.
+func List(userId int, unreadOnly bool, limit int) ([]Notification, error) {
+	query := "SELECT id, type, title, body, link, isRead, created FROM notifications WHERE userId = ?"
+	if unreadOnly {
+		query += " AND isRead = 0"
+	}
+	query += " ORDER BY created DESC, id DESC LIMIT ?"
+
+	rows, err := db.Query(query, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	list := []Notification{}
+
+	for rows.Next() {
+		n := Notification{}
+		isRead := 0
+		err := rows.Scan(&n.ID, &n.Type, &n.Title, &n.Body, &n.Link, &isRead, &n.Created)
+		if err != nil {
+			return nil, err
+		}
+		n.Read = isRead == 1
+		list = append(list, n)
+	}
+
+	return list, rows.Err()
+}
+
+func UnreadCount(userId int) (int, error) {
+	count := 0
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE userId = ? AND isRead = 0", userId).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks one of the user's notifications as read. Ids belonging to other users are ignored.
+func MarkRead(userId int, id int) error {
+	_, err := db.Exec("UPDATE notifications SET isRead = 1 WHERE id = ? AND userId = ?", id, userId)
+	return err
+}
+
+func MarkAllRead(userId int) error {
+	_, err := db.Exec("UPDATE notifications SET isRead = 1 WHERE userId = ? AND isRead = 0", userId)
+	return err
+}
@@ -0,0 +1,9 @@
+package notifications
+
+import "database/sql"
+
+var db *sql.DB
+
+func Configure(database *sql.DB) {
+	db = database
+}
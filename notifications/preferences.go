@@ -0,0 +1,108 @@
+package notifications
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// These are the kinds of non-transactional email a user can opt out of. The values are also used in unsubscribe links.
+const (
+	CategoryDigest         = "digest"
+	CategoryEventReminders = "eventReminders"
+	CategoryCommentReplies = "commentReplies"
+	CategoryAdminNotices   = "adminNotices"
+)
+
+var ErrInvalidCategory = errors.New("notifications: invalid category")
+
+type Preferences struct {
+	Digest         bool `json:"digest"`
+	EventReminders bool `json:"event_reminders"`
+	CommentReplies bool `json:"comment_replies"`
+	AdminNotices   bool `json:"admin_notices"`
+}
+
+// DefaultPreferences is what a user who has never changed their preferences gets.
+var DefaultPreferences = Preferences{
+	Digest:         true,
+	EventReminders: true,
+	CommentReplies: true,
+	AdminNotices:   true,
+}
+
+func ValidCategory(category string) bool {
+	switch category {
+	case CategoryDigest, CategoryEventReminders, CategoryCommentReplies, CategoryAdminNotices:
+		return true
+	}
+	return false
+}
+
+func GetPreferences(userId int) (Preferences, error) {
+	p := Preferences{}
+	var digest, eventReminders, commentReplies, adminNotices int
+
+	err := db.QueryRow("SELECT digest, eventReminders, commentReplies, adminNotices FROM notificationPreferences WHERE userId = ?", userId).Scan(&digest, &eventReminders, &commentReplies, &adminNotices)
+	if err == sql.ErrNoRows {
+		return DefaultPreferences, nil
+	}
+	if err != nil {
+		return p, err
+	}
+
+	p.Digest = digest == 1
+	p.EventReminders = eventReminders == 1
+	p.CommentReplies = commentReplies == 1
+	p.AdminNotices = adminNotices == 1
+
+	return p, nil
+}
+
+func SetPreferences(userId int, p Preferences) error {
+	_, err := db.Exec("INSERT INTO notificationPreferences (userId, digest, eventReminders, commentReplies, adminNotices) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE digest = VALUES(digest), eventReminders = VALUES(eventReminders), commentReplies = VALUES(commentReplies), adminNotices = VALUES(adminNotices)",
+		userId, p.Digest, p.EventReminders, p.CommentReplies, p.AdminNotices)
+	return err
+}
+
+// Allows reports whether the user wants to receive email of the given category.
+func Allows(userId int, category string) (bool, error) {
+	p, err := GetPreferences(userId)
+	if err != nil {
+		return false, err
+	}
+
+	switch category {
+	case CategoryDigest:
+		return p.Digest, nil
+	case CategoryEventReminders:
+		return p.EventReminders, nil
+	case CategoryCommentReplies:
+		return p.CommentReplies, nil
+	case CategoryAdminNotices:
+		return p.AdminNotices, nil
+	}
+	return false, ErrInvalidCategory
+}
+
+// Unsubscribe turns off a single category for the user, leaving the others alone.
+func Unsubscribe(userId int, category string) error {
+	p, err := GetPreferences(userId)
+	if err != nil {
+		return err
+	}
+
+	switch category {
+	case CategoryDigest:
+		p.Digest = false
+	case CategoryEventReminders:
+		p.EventReminders = false
+	case CategoryCommentReplies:
+		p.CommentReplies = false
+	case CategoryAdminNotices:
+		p.AdminNotices = false
+	default:
+		return ErrInvalidCategory
+	}
+
+	return SetPreferences(userId, p)
+}
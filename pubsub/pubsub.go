@@ -0,0 +1,132 @@
+package pubsub
+
+import "sync"
+
+// historySize is how many messages are kept per school so that clients reconnecting with Last-Event-ID can catch up.
+const historySize = 100
+
+// subscriberBuffer is how many messages can be waiting for a subscriber before it is dropped. A dropped client will
+// reconnect and catch up from the history.
+const subscriberBuffer = 16
+
+// TypeReset is the type of the message a subscriber gets instead of a backlog when some of the messages it missed are
+// no longer in the history, so it has to fetch everything again.
+const TypeReset = "reset"
+
+type Message struct {
+	ID   uint64
+	Type string
+	Data interface{}
+}
+
+type Broker struct {
+	mu          sync.Mutex
+	closed      bool
+	lastID      uint64
+	subscribers map[int]map[chan Message]struct{}
+	history     map[int][]Message
+
+	// trimmed is the id of the newest message that fell out of each topic's history
+	trimmed map[int]uint64
+}
+
+// Schools carries live updates about schools, keyed by school id.
+var Schools = NewBroker()
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: map[int]map[chan Message]struct{}{},
+		history:     map[int][]Message{},
+		trimmed:     map[int]uint64{},
+	}
+}
+
+// Publish sends a message to everyone subscribed to the topic.
+func (b *Broker) Publish(topic int, messageType string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	m := Message{ID: b.lastID, Type: messageType, Data: data}
+
+	history := append(b.history[topic], m)
+	if len(history) > historySize {
+		b.trimmed[topic] = history[len(history)-historySize-1].ID
+		history = history[len(history)-historySize:]
+	}
+	b.history[topic] = history
+
+	for ch := range b.subscribers[topic] {
+		select {
+		case ch <- m:
+		default:
+			// too slow to keep up, so let it reconnect
+			delete(b.subscribers[topic], ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe starts listening to a topic. The messages after lastID are returned as the backlog; pass 0 to skip it. If
+// some of them are no longer in the history, or lastID is from before the server restarted, the backlog is a single
+// TypeReset message instead. The channel is closed if the subscriber falls too far behind, and cancel must be called
+// once the subscriber is done.
+func (b *Broker) Subscribe(topic int, lastID uint64) (<-chan Message, []Message, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Message
+	if lastID > 0 {
+		if lastID < b.trimmed[topic] || lastID > b.lastID {
+			backlog = []Message{{ID: b.lastID, Type: TypeReset}}
+		} else {
+			for _, m := range b.history[topic] {
+				if m.ID > lastID {
+					backlog = append(backlog, m)
+				}
+			}
+		}
+	}
+
+	ch := make(chan Message, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return ch, backlog, func() {}
+	}
+
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = map[chan Message]struct{}{}
+	}
+	b.subscribers[topic][ch] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[topic][ch]; ok {
+			delete(b.subscribers[topic], ch)
+			close(ch)
+		}
+		if len(b.subscribers[topic]) == 0 {
+			delete(b.subscribers, topic)
+		}
+	}
+
+	return ch, backlog, cancel
+}
+
+// Close disconnects every subscriber, and any that subscribe later, so that open streams end when the server shuts
+// down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for topic, subscribers := range b.subscribers {
+		for ch := range subscribers {
+			close(ch)
+		}
+		delete(b.subscribers, topic)
+	}
+}
@@ -0,0 +1,51 @@
+package pubsub
+
+import "testing"
+
+func TestSubscribeBacklog(t *testing.T) {
+	b := NewBroker()
+	for i := 0; i < historySize+10; i++ {
+		b.Publish(1, "school", i)
+		b.Publish(2, "other", i)
+	}
+
+	// topic 1 has the odd ids, and kept the last historySize of them
+	oldest := uint64(2*10 + 1)
+	newest := uint64(2*(historySize+10) - 1)
+
+	tests := []struct {
+		name      string
+		lastID    uint64
+		wantFirst uint64
+		wantCount int
+		wantReset bool
+	}{
+		{"no last id", 0, 0, 0, false},
+		{"up to date", newest, 0, 0, false},
+		{"one behind", newest - 2, newest, 1, false},
+		{"just before the oldest kept", oldest - 2, oldest, historySize, false},
+		{"before the oldest kept", oldest - 4, 0, 0, true},
+		{"from before a restart", newest + 100, 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, backlog, cancel := b.Subscribe(1, test.lastID)
+			defer cancel()
+
+			if test.wantReset {
+				if len(backlog) != 1 || backlog[0].Type != TypeReset || backlog[0].ID != newest+1 {
+					t.Errorf("got backlog %v, want a reset", backlog)
+				}
+				return
+			}
+
+			if len(backlog) != test.wantCount {
+				t.Fatalf("got %d messages, want %d", len(backlog), test.wantCount)
+			}
+			if len(backlog) > 0 && backlog[0].ID != test.wantFirst {
+				t.Errorf("the backlog starts at %d, want %d", backlog[0].ID, test.wantFirst)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	// one token every 10 seconds, up to 3
+	limit := Limit{Rate: 0.1, Burst: 3}
+
+	steps := []struct {
+		name       string
+		after      time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		resetAfter time.Duration
+	}{
+		{"first request takes from a full bucket", 0, true, 2, 0, 10 * time.Second},
+		{"second", 0, true, 1, 0, 20 * time.Second},
+		{"third empties it", 0, true, 0, 0, 30 * time.Second},
+		{"fourth is refused", 0, false, 0, 10 * time.Second, 30 * time.Second},
+		{"still refused part way through the refill", 4 * time.Second, false, 0, 6 * time.Second, 26 * time.Second},
+		{"allowed once a token is back", 6 * time.Second, true, 0, 0, 30 * time.Second},
+		{"refills no further than the burst", time.Hour, true, 2, 0, 10 * time.Second},
+	}
+
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	for _, step := range steps {
+		now = now.Add(step.after)
+
+		result, err := s.Take("ip:1", limit)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if result.Allowed != step.allowed || result.Remaining != step.remaining {
+			t.Errorf("%s: got allowed %v with %d remaining, want %v with %d", step.name, result.Allowed, result.Remaining, step.allowed, step.remaining)
+		}
+		if !closeTo(result.RetryAfter, step.retryAfter) {
+			t.Errorf("%s: RetryAfter is %v, want %v", step.name, result.RetryAfter, step.retryAfter)
+		}
+		if !closeTo(result.ResetAfter, step.resetAfter) {
+			t.Errorf("%s: ResetAfter is %v, want %v", step.name, result.ResetAfter, step.resetAfter)
+		}
+	}
+}
+
+func TestMemoryStoreKeysAreSeparate(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 1}
+
+	for _, key := range []string{"login:1", "login:2", "search:1"} {
+		result, _ := s.Take(key, limit)
+		if !result.Allowed {
+			t.Errorf("%s was refused, but its bucket is new", key)
+		}
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	s.lastSweep = now
+	limit := Limit{Rate: 1, Burst: 5}
+
+	s.Take("refilled", limit)
+	now = now.Add(sweepInterval - time.Second)
+	s.Take("recent", limit)
+	s.Take("recent", limit)
+
+	// the first bucket has been full for a while, the second needs another second
+	now = now.Add(time.Second)
+	s.Take("trigger", limit)
+
+	if _, ok := s.buckets["refilled"]; ok {
+		t.Error("sweep kept a bucket that had refilled")
+	}
+	if _, ok := s.buckets["recent"]; !ok {
+		t.Error("sweep forgot a bucket that hadn't refilled")
+	}
+}
+
+// closeTo allows for float rounding in the durations.
+func closeTo(got, want time.Duration) bool {
+	diff := got - want
+	return diff > -time.Millisecond && diff < time.Millisecond
+}
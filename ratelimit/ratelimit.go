@@ -0,0 +1,118 @@
+// Package ratelimit limits how often clients can call expensive routes, with a token bucket per client for each policy
+// in the config.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/whiskeybrav/studentclubportal-server/api/apierr"
+	"github.com/whiskeybrav/studentclubportal-server/configuration"
+	"github.com/whiskeybrav/studentclubportal-server/logging"
+)
+
+// Limit is the size of a bucket and how fast it refills.
+type Limit struct {
+	// Rate is how many tokens are added each second
+	Rate  float64
+	Burst int
+}
+
+// Result is what's left in a bucket after taking a token from it.
+type Result struct {
+	Allowed   bool
+	Remaining int
+
+	// RetryAfter is how long until the next token, when none were left
+	RetryAfter time.Duration
+
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Store keeps the buckets. Servers that share a Store share their limits, so it can be swapped for one that's shared
+// when there's more than one server.
+type Store interface {
+	// Take takes a token from the bucket for key, which starts full.
+	Take(key string, limit Limit) (Result, error)
+}
+
+var Buckets Store
+
+var trustProxyHeaders bool
+
+func ConfigureRateLimit(config configuration.Config) {
+	trustProxyHeaders = config.RateLimit.TrustProxyHeaders
+
+	// memory is the only store so far, and Validate rejects any other
+	Buckets = NewMemoryStore()
+}
+
+// LimitFor turns a policy into the Limit for its buckets.
+func LimitFor(policy configuration.RateLimitPolicy) Limit {
+	burst := policy.Burst
+	if burst == 0 {
+		burst = policy.Requests
+	}
+	return Limit{Rate: float64(policy.Requests) / float64(policy.PerSeconds), Burst: burst}
+}
+
+// Middleware limits the routes it's added to as the policy says. A request that's over the limit gets rate_limited,
+// with Retry-After saying when to try again.
+func Middleware(policy configuration.RateLimitPolicy) echo.MiddlewareFunc {
+	limit := LimitFor(policy)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			result, err := Buckets.Take(policy.Name+":"+clientKey(c, policy.Key), limit)
+			if err != nil {
+				// better to let requests through than to take the routes down with the store
+				logging.FromContext(c).Error("checking rate limit", err)
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("X-RateLimit-Reset", seconds(result.ResetAfter))
+
+			if !result.Allowed {
+				header.Set("Retry-After", seconds(result.RetryAfter))
+				return apierr.New(http.StatusTooManyRequests, "rate_limited")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// clientKey is who a request is counted against.
+func clientKey(c echo.Context, key string) string {
+	if key == "user" {
+		if userId, ok := c.Get(logging.UserIDKey).(int); ok && userId != -1 {
+			return "user:" + strconv.Itoa(userId)
+		}
+	}
+	return "ip:" + clientIP(c)
+}
+
+func clientIP(c echo.Context) string {
+	if trustProxyHeaders {
+		return c.RealIP()
+	}
+
+	host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		return c.Request().RemoteAddr
+	}
+	return host
+}
+
+// seconds rounds up, so clients that wait that long will have a token.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
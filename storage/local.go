@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalBackend stores files in a directory on the local disk.
+type LocalBackend struct {
+	Root string
+}
+
+func NewLocalBackend(root string) *LocalBackend {
+	if root == "" {
+		root = "./uploads"
+	}
+	return &LocalBackend{Root: root}
+}
+
+func (b *LocalBackend) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, "/\\") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(b.Root, key), nil
+}
+
+func (b *LocalBackend) Put(key string, r io.Reader) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(b.Root, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		os.Remove(p)
+		return err
+	}
+
+	return f.Close()
+}
+
+func (b *LocalBackend) Open(key string) (io.ReadCloser, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (b *LocalBackend) Delete(key string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
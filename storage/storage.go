@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"errors"
+	"io"
+
+	"github.com/whiskeybrav/studentclubportal-server/configuration"
+)
+
+// ErrInvalidKey is returned when a key could escape the storage root or is otherwise unusable.
+var ErrInvalidKey = errors.New("storage: invalid key")
+
+// Backend is a place where uploaded files are kept. Keys are opaque strings generated by the server.
+type Backend interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var Store Backend
+
+func ConfigureStorage(config configuration.Config) {
+	// local is the only backend so far, and configuration.Validate rejects any other
+	Store = NewLocalBackend(config.Storage.Path)
+}
@@ -0,0 +1,19 @@
+package util
+
+import "strings"
+
+// usStates are the USPS codes of the states, DC and the territories with schools.
+var usStates = map[string]bool{
+	"AL": true, "AK": true, "AZ": true, "AR": true, "CA": true, "CO": true, "CT": true, "DE": true, "FL": true,
+	"GA": true, "HI": true, "ID": true, "IL": true, "IN": true, "IA": true, "KS": true, "KY": true, "LA": true,
+	"ME": true, "MD": true, "MA": true, "MI": true, "MN": true, "MS": true, "MO": true, "MT": true, "NE": true,
+	"NV": true, "NH": true, "NJ": true, "NM": true, "NY": true, "NC": true, "ND": true, "OH": true, "OK": true,
+	"OR": true, "PA": true, "RI": true, "SC": true, "SD": true, "TN": true, "TX": true, "UT": true, "VT": true,
+	"VA": true, "WA": true, "WV": true, "WI": true, "WY": true, "DC": true, "AS": true, "GU": true, "MP": true,
+	"PR": true, "VI": true,
+}
+
+// StateIsValid checks that the given string is a US state code, such as "CA".
+func StateIsValid(state string) bool {
+	return usStates[strings.ToUpper(state)]
+}
@@ -0,0 +1,9 @@
+package util
+
+import "net/url"
+
+// URLIsValid checks that the given string is an absolute http or https URL.
+func URLIsValid(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -1,3 +1,7 @@
 package version
 
 const Version string = "2019.11" // Versions are specified in the month-day format
+
+// SchemaVersion is the number of the newest file in migrations/, which the database has to be at for this build to
+// work. Bump it with every new migration.
+const SchemaVersion = 15
@@ -0,0 +1,33 @@
+package version
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_.*\.sql$`)
+
+func TestSchemaVersionMatchesMigrations(t *testing.T) {
+	files, err := os.ReadDir("../migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest := 0
+	for _, file := range files {
+		match := migrationFilePattern.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+		number, _ := strconv.Atoi(match[1])
+		if number > latest {
+			latest = number
+		}
+	}
+
+	if latest != SchemaVersion {
+		t.Errorf("SchemaVersion is %d, but the newest migration is %d", SchemaVersion, latest)
+	}
+}